@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/netip"
+	"os"
+	"strconv"
+
+	cw "github.com/BourgeoisBear/nicsearch/colwriter"
+	"github.com/BourgeoisBear/nicsearch/rdap"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+// parent objects walked up from the one queried, looking for abuse contacts
+const AbuseMaxParents = 4
+
+// best abuse contact of an IP or ASN, with where it was found
+type AbuseResult struct {
+	rdap.AbuseContact
+	Object string `json:"object"` // handle of network/autnum carrying it
+	URL    string `json:"url"`    // RDAP URL of that object
+	Level  int    `json:"level"`  // 0 for the object queried, 1 for its parent...
+
+	// address range of the network queried, when an IP was, and whether
+	// it is a leaf (see isLeafNetwork)
+	first, last netip.Addr
+	leaf        bool
+}
+
+/*
+network queried covers ip, and holds no more-specific networks that
+could name another contact for it
+*/
+func (pR *AbuseResult) Covers(ip netip.Addr) bool {
+	return pR.leaf && pR.first.IsValid() && (pR.first.Compare(ip) <= 0) && (ip.Compare(pR.last) <= 0)
+}
+
+/*
+abuse contact of tgt: the first 'abuse' role entity or 'abuse-mailbox'
+remark of the object queried or its parents, else its (or its parents')
+technical, administrative or registrant contact.
+*/
+func (m *Modes) FindAbuse(ctx context.Context, db *bbolt.DB, tgt RdapTarget) (*AbuseResult, error) {
+
+	url, bsJSON, err := m.rdapByTarget(ctx, db, tgt)
+	if err != nil {
+		return nil, err
+	}
+
+	var sObj []rdap.Object
+	var sUrl []string
+	var first, last netip.Addr
+	var bLeaf bool
+	mSeen := make(map[string]bool)
+
+	for {
+		var obj rdap.Object
+		if err = m.Rdap.Decode(bsJSON, &obj); err != nil {
+			return nil, errors.WithMessage(err, url)
+		}
+
+		if len(sObj) == 0 {
+			first, _ = netip.ParseAddr(obj.StartAddress)
+			last, _ = netip.ParseAddr(obj.EndAddress)
+			var oNet rdap.IPNetwork
+			bLeaf = tgt.IP.IsValid() && (m.Rdap.Decode(bsJSON, &oNet) == nil) && isLeafNetwork(&oNet, first, last)
+		}
+
+		// answers to widened CIDR queries may be the same object
+		if mSeen[obj.Handle] {
+			break
+		}
+		mSeen[obj.Handle] = true
+
+		if ct, ok := obj.Abuse(); ok {
+			return &AbuseResult{AbuseContact: ct, Object: obj.Handle, URL: url, Level: len(sObj), first: first, last: last, leaf: bLeaf}, nil
+		}
+		sObj = append(sObj, obj)
+		sUrl = append(sUrl, url)
+
+		if len(sObj) > AbuseMaxParents {
+			break
+		}
+		urlUp, ok := obj.ParentUrl(url)
+		if !ok {
+			break
+		}
+
+		// keep what was found so far when a parent lookup fails
+		bsUp, err := m.rdapGet(ctx, urlUp)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			break
+		}
+		url, bsJSON = urlUp, bsUp
+	}
+
+	for ix := range sObj {
+		if ct, ok := sObj[ix].Fallback(); ok {
+			return &AbuseResult{AbuseContact: ct, Object: sObj[ix].Handle, URL: sUrl[ix], Level: ix, first: first, last: last, leaf: bLeaf}, nil
+		}
+	}
+	// range still given, so callers can skip other addresses of the network
+	return &AbuseResult{first: first, last: last, leaf: bLeaf}, ENoAbuseContact
+}
+
+func (v CmdRDAP_Abuse) Exec(cep CmdExecParams) error {
+
+	res, err := cep.FindAbuse(cep.Ctx, cep.Db, v.RdapTarget)
+	if err != nil {
+		return err
+	}
+
+	if v.JSON {
+		bsJSON, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		return cep.PrintJSON(os.Stdout, bsJSON)
+	}
+
+	writerCfg := cw.Cfg{Spacer: "|", Pad: cep.Pretty}
+	ccfg := []cw.ColCfg{
+		cw.ColCfg{Wid: 32, Title: "EMAIL"},
+		cw.ColCfg{Wid: 16, Title: "HANDLE"},
+		cw.ColCfg{Wid: 24, Title: "NAME"},
+		cw.ColCfg{Wid: 8, Title: "RULE"},
+		cw.ColCfg{Wid: 24, Title: "OBJECT"},
+		cw.ColCfg{Wid: 3, Title: "LVL", Rt: true},
+		cw.ColCfg{Title: "URL"},
+	}
+	parts := []interface{}{
+		res.Email,
+		res.Handle,
+		res.Name,
+		res.Rule,
+		res.Object,
+		strconv.Itoa(res.Level),
+		res.URL,
+	}
+	if cep.PrependQuery {
+		ccfg = append([]cw.ColCfg{cw.ColCfg{Wid: cep.MaxCmdLen}}, ccfg...)
+		parts = append([]interface{}{cep.Cmd}, parts...)
+	}
+
+	_, err = writerCfg.NewWriterFuncs(ccfg)(os.Stdout, parts...)
+	return err
+}
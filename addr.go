@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+var g_defangReplacer = strings.NewReplacer(
+	"[.]", ".", "(.)", ".", "{.}", ".",
+	"[DOT]", ".", "(DOT)", ".", "{DOT}", ".",
+	"[:]", ":", "(:)", ":",
+)
+
+/*
+Tolerant address parser for IPs copied from logs & reports.  Accepts:
+
+	1.2.3.4:443           address with port
+	[2001:db8::1]:80      bracketed IPv6, with or without port
+	16909060              decimal integer
+	0x01020304            hexadecimal integer
+	001.002.003.004       zero-padded (decimal) octets
+	1[.]2[.]3[.]4         defanged
+*/
+func ParseAddrLoose(sz string) (netip.Addr, error) {
+
+	szIn := sz
+	fnErr := func(format string, args ...interface{}) error {
+		return fmt.Errorf("invalid IP '%s': %s", szIn, fmt.Sprintf(format, args...))
+	}
+
+	sz = strings.Trim(strings.TrimSpace(sz), `"'<>,;`)
+	sz = g_defangReplacer.Replace(strings.ToUpper(sz))
+	sz = strings.TrimSuffix(sz, ".")
+	if len(sz) == 0 {
+		return netip.Addr{}, fnErr("empty address")
+	}
+
+	if ip, err := netip.ParseAddr(sz); err == nil {
+		return ip, nil
+	}
+
+	// bracketed IPv6, address with port
+	if strings.HasPrefix(sz, "[") && strings.HasSuffix(sz, "]") {
+		sz = sz[1 : len(sz)-1]
+		if ip, err := netip.ParseAddr(sz); err == nil {
+			return ip, nil
+		}
+	} else if strings.Count(sz, ":") == 1 || strings.HasPrefix(sz, "[") {
+		ap, err := netip.ParseAddrPort(sz)
+		if err != nil {
+			return netip.Addr{}, fnErr("bad address:port (%s)", strings.TrimPrefix(err.Error(), "invalid "))
+		}
+		return ap.Addr(), nil
+	}
+
+	if strings.Contains(sz, ":") {
+		return netip.Addr{}, fnErr("not a valid IPv6 address")
+	}
+
+	// integer forms
+	if !strings.Contains(sz, ".") {
+
+		base := 10
+		digits := sz
+		if strings.HasPrefix(sz, "0X") {
+			base = 16
+			digits = sz[2:]
+		}
+
+		n, err := strconv.ParseUint(digits, base, 64)
+		if err != nil {
+			return netip.Addr{}, fnErr("not an address, nor a decimal/hex integer")
+		}
+		if n > 0xFFFFFFFF {
+			return netip.Addr{}, fnErr("integer exceeds IPv4 range (max 4294967295)")
+		}
+		return netip.AddrFrom4([4]byte{
+			byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n),
+		}), nil
+	}
+
+	// zero-padded or hex octets
+	parts := strings.Split(sz, ".")
+	if len(parts) != 4 {
+		return netip.Addr{}, fnErr("expected 4 octets, found %d", len(parts))
+	}
+
+	var bs [4]byte
+	for ix, part := range parts {
+
+		base := 10
+		if strings.HasPrefix(part, "0X") {
+			base = 16
+			part = part[2:]
+		}
+
+		n, err := strconv.ParseUint(part, base, 64)
+		if err != nil {
+			return netip.Addr{}, fnErr("octet %d ('%s') is not a number", ix+1, parts[ix])
+		}
+		if n > 255 {
+			return netip.Addr{}, fnErr("octet %d (%d) exceeds 255", ix+1, n)
+		}
+		bs[ix] = byte(n)
+	}
+
+	return netip.AddrFrom4(bs), nil
+}
+
+// prefix with a tolerant address part, or a lone address as a host prefix
+func ParsePrefixLoose(sz string) (netip.Prefix, error) {
+
+	szAddr, szBits, bHasBits := strings.Cut(strings.TrimSpace(sz), "/")
+
+	ip, err := ParseAddrLoose(szAddr)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	if !bHasBits {
+		return netip.PrefixFrom(ip, ip.BitLen()), nil
+	}
+
+	nBits, err := strconv.Atoi(szBits)
+	if (err != nil) || (nBits < 0) || (nBits > ip.BitLen()) {
+		return netip.Prefix{}, fmt.Errorf(
+			"invalid prefix '%s': length must be 0-%d", sz, ip.BitLen(),
+		)
+	}
+	return netip.PrefixFrom(ip, nBits), nil
+}
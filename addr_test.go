@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestParseAddrLoose(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		want string // empty for an error
+	}{
+		{"1.2.3.4", "1.2.3.4"},
+		{" 1.2.3.4 ", "1.2.3.4"},
+		{"1.2.3.4.", "1.2.3.4"},
+		{`"1.2.3.4",`, "1.2.3.4"},
+		{"<1.2.3.4>", "1.2.3.4"},
+		{"1.2.3.4:443", "1.2.3.4"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"2001:DB8::1", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"[2001:db8::1]:80", "2001:db8::1"},
+		{"16909060", "1.2.3.4"},
+		{"0", "0.0.0.0"},
+		{"4294967295", "255.255.255.255"},
+		{"0x01020304", "1.2.3.4"},
+		{"0XFFFFFFFF", "255.255.255.255"},
+		{"001.002.003.004", "1.2.3.4"},
+		{"010.0.0.1", "10.0.0.1"},
+		{"0x7f.0.0.1", "127.0.0.1"},
+		{"1[.]2[.]3[.]4", "1.2.3.4"},
+		{"1(.)2(.)3(.)4", "1.2.3.4"},
+		{"1[dot]2[dot]3[dot]4", "1.2.3.4"},
+		{"2001[:]db8[:][:]1", "2001:db8::1"},
+
+		{"", ""},
+		{"   ", ""},
+		{"4294967296", ""},
+		{"0x100000000", ""},
+		{"example.com", ""},
+		{"1.2.3", ""},
+		{"1.2.3.4.5", ""},
+		{"1.2.3.256", ""},
+		{"1.2.3.x", ""},
+		{"1.2.3.4:99999", ""},
+		{"2001:db8::g", ""},
+		{"[1.2.3.4", ""},
+	}
+
+	for _, tc := range tests {
+		ip, err := ParseAddrLoose(tc.in)
+		if len(tc.want) == 0 {
+			if err == nil {
+				t.Errorf("'%s': got %s, want error", tc.in, ip)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("'%s': %v", tc.in, err)
+		} else if ip != netip.MustParseAddr(tc.want) {
+			t.Errorf("'%s': got %s, want %s", tc.in, ip, tc.want)
+		}
+	}
+}
+
+func TestParsePrefixLoose(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		want string // empty for an error
+	}{
+		{"1.2.3.0/24", "1.2.3.0/24"},
+		{"1[.]2[.]3[.]0/24", "1.2.3.0/24"},
+		{"1.2.3.4", "1.2.3.4/32"},
+		{"2001:db8::/32", "2001:db8::/32"},
+		{"2001:db8::1", "2001:db8::1/128"},
+		{"0.0.0.0/0", "0.0.0.0/0"},
+
+		{"1.2.3.0/33", ""},
+		{"1.2.3.0/-1", ""},
+		{"1.2.3.0/", ""},
+		{"2001:db8::/129", ""},
+		{"bogus/24", ""},
+	}
+
+	for _, tc := range tests {
+		pfx, err := ParsePrefixLoose(tc.in)
+		if len(tc.want) == 0 {
+			if err == nil {
+				t.Errorf("'%s': got %s, want error", tc.in, pfx)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("'%s': %v", tc.in, err)
+		} else if pfx != netip.MustParsePrefix(tc.want) {
+			t.Errorf("'%s': got %s, want %s", tc.in, pfx, tc.want)
+		}
+	}
+}
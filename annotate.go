@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// delegation of an IP, with its organization's (lowest) ASN
+type IpOrg struct {
+	Row    Row
+	ASN    uint32
+	HasASN bool
+	AsName []byte
+}
+
+func IpToOrgTx(tx *bbolt.Tx, ip netip.Addr, ss StatusSet) (IpOrg, error) {
+
+	var ret IpOrg
+	var err error
+	if ret.Row, err = IpToRowTx(tx, ip, ss); err != nil {
+		return ret, err
+	}
+
+	if err = ret.findASN(tx); err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+func (pO *IpOrg) findASN(tx *bbolt.Tx) error {
+
+	sAsns, err := FindAssociatedTx(tx, pO.Row.Registry, pO.Row.RegId, isAsnLine)
+	if (err != nil) || (len(sAsns) == 0) {
+		return err
+	}
+
+	sort.Slice(sAsns, func(i, j int) bool { return sAsns[i].ASN < sAsns[j].ASN })
+	pO.ASN = sAsns[0].ASN
+	pO.HasASN = true
+
+	bsASN := Uint32ToBytes(pO.ASN)
+	pO.AsName, _ = AsnToNameTx(tx, bsASN[:])
+	return nil
+}
+
+// address found in free text, at line[Start:End]
+type TextAddr struct {
+	Start, End int
+	IP         netip.Addr
+}
+
+var (
+	g_rxAddrRun  = regexp.MustCompile(`[0-9A-Fa-f:.]+`)
+	g_rxDigitRun = regexp.MustCompile(`[0-9.]+`)
+)
+
+func isDigit(c byte) bool {
+	return (c >= '0') && (c <= '9')
+}
+
+func isWordByte(c byte) bool {
+	return (c == '_') || isDigit(c) ||
+		((c >= 'A') && (c <= 'Z')) ||
+		((c >= 'a') && (c <= 'z'))
+}
+
+// start/end of line[ixStart:ixEnd] are not inside of a larger word
+func isWordBounded(line string, ixStart, ixEnd int) bool {
+	if (ixStart > 0) && isWordByte(line[ixStart-1]) {
+		return false
+	}
+	if (ixEnd < len(line)) && isWordByte(line[ixEnd]) {
+		return false
+	}
+	return true
+}
+
+// IPv6 address of a run, dropping trailing punctuation until it parses
+func trimmedTextAddr6(szRun string, ixStart int) (TextAddr, bool) {
+	for len(szRun) > 0 {
+		if ip, err := netip.ParseAddr(szRun); err == nil {
+			return TextAddr{Start: ixStart, End: ixStart + len(szRun), IP: ip}, true
+		}
+		szNext := strings.TrimRight(szRun, ":.")
+		if szNext == szRun {
+			break
+		}
+		szRun = szNext
+	}
+	return TextAddr{}, false
+}
+
+/*
+All IPv4 & IPv6 addresses in a line of free text (logs, reports).
+Dotted runs of more than 4 numbers (versions, OIDs), MAC addresses,
+and times of day are not mistaken for addresses.
+*/
+func FindTextAddrs(line string) []TextAddr {
+
+	var ret []TextAddr
+	for _, run := range g_rxAddrRun.FindAllStringIndex(line, -1) {
+
+		szRun := line[run[0]:run[1]]
+
+		// IPv6, possibly followed by sentence punctuation
+		if strings.Count(szRun, ":") >= 2 {
+			ixOfs := 0
+			if strings.HasPrefix(szRun, ":") && !strings.HasPrefix(szRun, "::") {
+				ixOfs = 1
+			}
+			ta, ok := trimmedTextAddr6(szRun[ixOfs:], run[0]+ixOfs)
+			if ok && isWordBounded(line, ta.Start, ta.End) {
+				ret = append(ret, ta)
+				continue
+			}
+		}
+
+		// IPv4, as separate dotted quads inside of run (e.g. 'ip:1.2.3.4:80')
+		for _, sub := range g_rxDigitRun.FindAllStringIndex(szRun, -1) {
+
+			szQuad := strings.Trim(szRun[sub[0]:sub[1]], ".")
+			if strings.Count(szQuad, ".") != 3 {
+				continue
+			}
+			ip, err := netip.ParseAddr(szQuad)
+			if err != nil {
+				continue
+			}
+			ixStart := run[0] + sub[0] + strings.Index(szRun[sub[0]:sub[1]], szQuad)
+			if !isWordBounded(line, ixStart, ixStart+len(szQuad)) {
+				continue
+			}
+			ret = append(ret, TextAddr{Start: ixStart, End: ixStart + len(szQuad), IP: ip})
+		}
+	}
+
+	return ret
+}
+
+// entries kept in annotation caches, before they are reset
+const AnnotateCacheMax = 100000
+
+type Annotator struct {
+	*Modes
+	Db     *bbolt.DB
+	Append bool
+
+	mLabels map[netip.Addr]string
+}
+
+// '[AS15169 GOOGLE US arin]' label of an address, empty when unknown
+func (pA *Annotator) Label(ip netip.Addr) (string, error) {
+
+	if sz, ok := pA.mLabels[ip]; ok {
+		return sz, nil
+	}
+
+	ipLookup := ip.Unmap()
+	var org IpOrg
+	err := pA.Db.View(func(tx *bbolt.Tx) error {
+		var e2 error
+		org, e2 = IpToOrgTx(tx, ipLookup, pA.Statuses)
+		return e2
+	})
+
+	var parts []string
+	switch err {
+
+	case nil:
+		if org.HasASN {
+			parts = append(parts, "AS"+FormatASN(org.ASN, pA.AsDot))
+			szName := string(org.AsName)
+			szName = strings.TrimSuffix(szName, ", "+string(org.Row.Cc))
+			if len(szName) > 0 {
+				parts = append(parts, szName)
+			}
+		}
+		parts = append(parts, string(org.Row.Cc), strings.ToLower(string(org.Row.Registry)))
+
+	case ENotFound:
+		if sb, ok := SpecialBlockOf(ipLookup); ok {
+			parts = append(parts, sb.Name)
+		}
+
+	default:
+		return "", err
+	}
+
+	sz := ""
+	if len(parts) > 0 {
+		sz = "[" + strings.Join(parts, " ") + "]"
+	}
+
+	if pA.mLabels == nil || len(pA.mLabels) >= AnnotateCacheMax {
+		pA.mLabels = make(map[netip.Addr]string)
+	}
+	pA.mLabels[ip] = sz
+	return sz, nil
+}
+
+// inline labels go after any closing bracket & port of an address
+func labelPos(line string, ixEnd int) int {
+
+	if (ixEnd < len(line)) && (line[ixEnd] == ']') {
+		ixEnd += 1
+	}
+	if (ixEnd+1 < len(line)) && (line[ixEnd] == ':') && isDigit(line[ixEnd+1]) {
+		ixEnd += 1
+		for (ixEnd < len(line)) && isDigit(line[ixEnd]) {
+			ixEnd += 1
+		}
+	}
+	return ixEnd
+}
+
+func (pA *Annotator) AnnotateLine(line string) (string, error) {
+
+	sAddrs := FindTextAddrs(line)
+	if len(sAddrs) == 0 {
+		return line, nil
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(line) + 40*len(sAddrs))
+
+	if pA.Append {
+
+		sb.WriteString(line)
+		mSeen := make(map[netip.Addr]bool)
+		for _, ta := range sAddrs {
+			if mSeen[ta.IP] {
+				continue
+			}
+			mSeen[ta.IP] = true
+			label, err := pA.Label(ta.IP)
+			if err != nil {
+				return line, err
+			}
+			if len(label) > 0 {
+				fmt.Fprintf(&sb, " [%s %s", ta.IP, label[1:])
+			}
+		}
+		return sb.String(), nil
+	}
+
+	ixPrev := 0
+	for _, ta := range sAddrs {
+		label, err := pA.Label(ta.IP)
+		if (err != nil) || (len(label) == 0) {
+			if err != nil {
+				return line, err
+			}
+			continue
+		}
+		ixEnd := labelPos(line, ta.End)
+		sb.WriteString(line[ixPrev:ixEnd])
+		sb.WriteString(" ")
+		sb.WriteString(label)
+		ixPrev = ixEnd
+	}
+	sb.WriteString(line[ixPrev:])
+	return sb.String(), nil
+}
+
+/*
+Copy iRd to iWri, annotating every IP address found.  Output is
+flushed whenever input is idle, so 'tail -f' pipes stay live.
+*/
+func (pA *Annotator) Run(iRd io.Reader, iWri io.Writer) error {
+
+	br := bufio.NewReader(iRd)
+	bw := bufio.NewWriter(iWri)
+	defer bw.Flush()
+
+	for {
+		line, errRead := br.ReadString('\n')
+		if len(line) > 0 {
+
+			szEol := ""
+			if strings.HasSuffix(line, "\n") {
+				szEol = "\n"
+				line = strings.TrimSuffix(line, "\n")
+				if strings.HasSuffix(line, "\r") {
+					szEol = "\r\n"
+					line = strings.TrimSuffix(line, "\r")
+				}
+			}
+
+			out, err := pA.AnnotateLine(line)
+			if err != nil {
+				return err
+			}
+			if _, err = bw.WriteString(out + szEol); err != nil {
+				return err
+			}
+		}
+
+		if errRead == io.EOF {
+			return nil
+		}
+		if errRead != nil {
+			return errRead
+		}
+		if br.Buffered() == 0 {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// annotation style of -annotate
+func ParseAnnotateMode(sz string) (bool, error) {
+	switch strings.ToLower(sz) {
+	case "inline":
+		return false, nil
+	case "append":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid -annotate mode '%s' (expected 'inline' or 'append')", sz)
+}
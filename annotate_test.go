@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindTextAddrs(t *testing.T) {
+
+	tests := []struct {
+		line string
+		want []string // addresses as found in line, in order
+	}{
+		{"", nil},
+		{"no addresses here", nil},
+		{"1.2.3.4", []string{"1.2.3.4"}},
+		{"from 1.2.3.4 to 5.6.7.8.", []string{"1.2.3.4", "5.6.7.8"}},
+		{"(1.2.3.4), [5.6.7.8]", []string{"1.2.3.4", "5.6.7.8"}},
+		{"ip:172.104.6.84:80", []string{"172.104.6.84"}},
+		{"src=10.0.0.1,dst=10.0.0.2", []string{"10.0.0.1", "10.0.0.2"}},
+		{"2001:db8::1", []string{"2001:db8::1"}},
+		{"from 2001:db8::1.", []string{"2001:db8::1"}},
+		{"listen [2001:db8::1]:443", []string{"2001:db8::1"}},
+		{"at ::1 and ::ffff:1.2.3.4", []string{"::1", "::ffff:1.2.3.4"}},
+		{"v4 1.2.3.4 & v6 fe80::1", []string{"1.2.3.4", "fe80::1"}},
+
+		// not addresses
+		{"version 1.2.3.4.5", nil},
+		{"oid 1.3.6.1.4.1", nil},
+		{"mac 00:1a:2b:3c:4d:5e", nil},
+		{"at 12:34:56", nil},
+		{"1.2.3.256", nil},
+		{"v1.2.3.4", nil},
+		{"1.2.3.4a", nil},
+		{"abc2001:db8::1", nil},
+	}
+
+	for _, tc := range tests {
+		var got []string
+		for _, ta := range FindTextAddrs(tc.line) {
+			if sz := tc.line[ta.Start:ta.End]; sz != ta.IP.String() {
+				t.Errorf("'%s': span '%s' holds %s", tc.line, sz, ta.IP)
+			}
+			got = append(got, ta.IP.String())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("'%s': got %q, want %q", tc.line, got, tc.want)
+		}
+	}
+}
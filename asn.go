@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parse ASN in asplain (15169), asdot (1.10), or AS-prefixed (AS15169) notation
+func ParseASN(sz string) (uint32, error) {
+
+	szIn := sz
+	sz = strings.TrimSpace(sz)
+	if len(sz) > 2 && strings.EqualFold(sz[:2], "AS") {
+		sz = sz[2:]
+	}
+
+	hi, lo, bDot := strings.Cut(sz, ".")
+	if !bDot {
+		n, err := strconv.ParseUint(sz, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("'%s' is not a valid ASN (expected 0 to 4294967295)", szIn)
+		}
+		return uint32(n), nil
+	}
+
+	nHi, eHi := strconv.ParseUint(hi, 10, 16)
+	nLo, eLo := strconv.ParseUint(lo, 10, 16)
+	if (eHi != nil) || (eLo != nil) {
+		return 0, fmt.Errorf("'%s' is not a valid asdot ASN (expected 0.0 to 65535.65535)", szIn)
+	}
+	return uint32(nHi<<16 | nLo), nil
+}
+
+// asplain, or asdot for 32-bit ASNs (RFC 5396)
+func FormatASN(nASN uint32, bAsDot bool) string {
+	if bAsDot && (nASN > 0xFFFF) {
+		return fmt.Sprintf("%d.%d", nASN>>16, nASN&0xFFFF)
+	}
+	return strconv.FormatUint(uint64(nASN), 10)
+}
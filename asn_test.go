@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestParseASN(t *testing.T) {
+
+	tests := []struct {
+		in   string
+		want uint32
+		bErr bool
+	}{
+		{"15169", 15169, false},
+		{" 15169 ", 15169, false},
+		{"AS15169", 15169, false},
+		{"as15169", 15169, false},
+		{"As15169", 15169, false},
+		{"0", 0, false},
+		{"4294967295", 4294967295, false},
+		{"1.10", 65546, false},
+		{"AS1.10", 65546, false},
+		{"0.65535", 65535, false},
+		{"65535.65535", 4294967295, false},
+
+		{"", 0, true},
+		{"AS", 0, true},
+		{"ASN15169", 0, true},
+		{"-1", 0, true},
+		{"4294967296", 0, true},
+		{"1.65536", 0, true},
+		{"65536.0", 0, true},
+		{"1.", 0, true},
+		{".1", 0, true},
+		{"1.2.3", 0, true},
+		{"GOOGLE", 0, true},
+	}
+
+	for _, tc := range tests {
+		n, err := ParseASN(tc.in)
+		if tc.bErr {
+			if err == nil {
+				t.Errorf("'%s': got %d, want error", tc.in, n)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("'%s': %v", tc.in, err)
+		} else if n != tc.want {
+			t.Errorf("'%s': got %d, want %d", tc.in, n, tc.want)
+		}
+	}
+}
+
+func TestFormatASN(t *testing.T) {
+
+	tests := []struct {
+		n      uint32
+		bAsDot bool
+		want   string
+	}{
+		{15169, false, "15169"},
+		{15169, true, "15169"},
+		{65535, true, "65535"},
+		{65546, false, "65546"},
+		{65546, true, "1.10"},
+		{4294967295, true, "65535.65535"},
+	}
+
+	for _, tc := range tests {
+		if got := FormatASN(tc.n, tc.bAsDot); got != tc.want {
+			t.Errorf("%d (asdot %v): got %s, want %s", tc.n, tc.bAsDot, got, tc.want)
+		}
+		if n, err := ParseASN(tc.want); (err != nil) || (n != tc.n) {
+			t.Errorf("'%s': round trip gave %d, %v", tc.want, n, err)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net/netip"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 
 	gerr "github.com/pkg/errors"
@@ -22,6 +23,7 @@ const (
 	ENotFound EFind = iota
 	EInvalidIpAddress
 	EInvalidQuery
+	ENoAbuseContact
 )
 
 func (v EFind) Error() string {
@@ -32,6 +34,8 @@ func (v EFind) Error() string {
 		return "invalid IP address"
 	case EInvalidQuery:
 		return "invalid query"
+	case ENoAbuseContact:
+		return "no abuse contact found"
 	}
 	return "invalid EFind value"
 }
@@ -56,10 +60,11 @@ type BucketIx int
 const (
 	BiRow    BucketIx = iota // map[rowIndex]rowData
 	BiAsn                    // map[uint32 ASN]rowIndex
-	BiV4                     // map[v4 address]rowIndex
-	BiV6                     // map[v6 address]rowIndex
+	BiV4                     // map[v4 address][]rowIndex
+	BiV6                     // map[v6 address][]rowIndex
 	BiId2Ix                  // map[registry][regId][rowIndex]interface{}
 	BiAsName                 // map[uint32 ASN]ASName
+	BiMeta                   // map[name]value
 	BiMAX
 )
 
@@ -77,6 +82,8 @@ func (k BucketIx) Key() []byte {
 		return []byte("id2ix")
 	case BiAsName:
 		return []byte("asname")
+	case BiMeta:
+		return []byte("meta")
 	}
 	return []byte{}
 }
@@ -116,9 +123,29 @@ func CreateBktFiller(db *bbolt.DB) (*BktFiller, error) {
 		}
 	}
 
+	// stamp index layout version
+	err = tx.Bucket(BiMeta.Key()).Put([]byte("version"), []byte(IndexVersion))
+	if err != nil {
+		return nil, err
+	}
+
 	return &BktFiller{db: db}, tx.Commit()
 }
 
+// bump when index contents/layout change, to force a rebuild
+const IndexVersion = "4"
+
+func IsIndexCurrent(db *bbolt.DB) bool {
+	bCurrent := false
+	db.View(func(tx *bbolt.Tx) error {
+		if bkt := tx.Bucket(BiMeta.Key()); bkt != nil {
+			bCurrent = string(bkt.Get([]byte("version"))) == IndexVersion
+		}
+		return nil
+	})
+	return bCurrent
+}
+
 func GetGzipSize(pF *os.File) (uint32, error) {
 
 	// 4 bytes from end
@@ -274,26 +301,69 @@ func (pb *BktFiller) scanlnDelegation(bkt []*bbolt.Bucket, bsLine []byte) error
 
 	// increment row pk, encode to []byte
 	pb.ixRowGlobal += 1
-	var bsRowIx [4]byte
+	var bsRowIx [RowIxLen]byte
 	binary.BigEndian.PutUint32(bsRowIx[:], pb.ixRowGlobal)
 	return insertRow(bkt, bsRowIx[:], bsLine)
 }
 
-func insertRow(bkt []*bbolt.Bucket, bsRowIx, bsLine []byte) error {
-
-	bsLine = bytes.ToUpper(bsLine)
-
-	// only include (allocated|assigned)
-	if !bytes.Contains(bsLine, []byte("|ASSIGNED|")) &&
-		// !bytes.Contains(bsLine, []byte("|RESERVED|")) &&
-		!bytes.Contains(bsLine, []byte("|ALLOCATED|")) {
-		return nil
-	}
+// bsLine should be upper-case
+func keepDelegation(bsLine []byte) bool {
 
 	// only include(asn, ipv4, ipv6)
 	if !bytes.Contains(bsLine, []byte("|ASN|")) &&
 		!bytes.Contains(bsLine, []byte("|IPV4|")) &&
 		!bytes.Contains(bsLine, []byte("|IPV6|")) {
+		return false
+	}
+
+	return true
+}
+
+// (allocated|assigned), bsLine should be upper-case
+func isDelegatedLine(bsLine []byte) bool {
+	return bytes.Contains(bsLine, []byte("|ASSIGNED|")) ||
+		bytes.Contains(bsLine, []byte("|ALLOCATED|"))
+}
+
+// bsLine should be upper-case
+func isAsnLine(bsLine []byte) bool {
+	return bytes.Contains(bsLine, []byte("|ASN|"))
+}
+
+/*
+update ASN index, but never shadow an allocated/assigned row with a
+reserved/available one starting at the same key.  each key is one ASN,
+so the rest of a larger block stays indexed.
+*/
+func putIndex(bkt []*bbolt.Bucket, ix BucketIx, key, bsRowIx []byte, bDelegated bool) error {
+
+	if !bDelegated {
+		if rowIxPrev := bkt[ix].Get(key); rowIxPrev != nil {
+			if isDelegatedLine(bkt[BiRow].Get(rowIxPrev)) {
+				return nil
+			}
+		}
+	}
+
+	return bkt[ix].Put(key, Clone(bsRowIx))
+}
+
+// width of a row index, in bytes
+const RowIxLen = 4
+
+/*
+update IP index, appending to the row indexes of rows starting at the
+same address (e.g. a reserved block with a smaller delegation at its
+start), so that none are shadowed.
+*/
+func putIpIndex(bkt *bbolt.Bucket, key, bsRowIx []byte) error {
+	return bkt.Put(key, append(Clone(bkt.Get(key)), bsRowIx...))
+}
+
+func insertRow(bkt []*bbolt.Bucket, bsRowIx, bsLine []byte) error {
+
+	bsLine = bytes.ToUpper(bsLine)
+	if !keepDelegation(bsLine) {
 		return nil
 	}
 
@@ -325,6 +395,7 @@ func insertRow(bkt []*bbolt.Bucket, bsRowIx, bsLine []byte) error {
 	}
 
 	// update asn, ipv4, ipv6 indices
+	bDelegated := isDelegatedLine(bsLine)
 	if oRow.IsType(TkASN) && (oRow.ValueInt > 0) {
 
 		// insert index for each ASN in range
@@ -332,7 +403,7 @@ func insertRow(bkt []*bbolt.Bucket, bsRowIx, bsLine []byte) error {
 		for asnAdd := oRow.ASN; asnAdd < asnLast; asnAdd += 1 {
 
 			bsASN := Uint32ToBytes(asnAdd)
-			err = bkt[BiAsn].Put(bsASN[:], Clone(bsRowIx))
+			err = putIndex(bkt, BiAsn, bsASN[:], bsRowIx, bDelegated)
 			if err != nil {
 				return gerr.WithMessage(err, "put ASN index")
 			}
@@ -346,20 +417,72 @@ func insertRow(bkt []*bbolt.Bucket, bsRowIx, bsLine []byte) error {
 
 		if oRow.IpStart.Is4() {
 			v := oRow.IpStart.As4()
-			err = bkt[BiV4].Put(v[:], Clone(bsRowIx))
+			err = putIpIndex(bkt[BiV4], v[:], bsRowIx)
 		} else {
 			v := oRow.IpStart.As16()
-			err = bkt[BiV6].Put(v[:], Clone(bsRowIx))
+			err = putIpIndex(bkt[BiV6], v[:], bsRowIx)
 		}
 
 		if err != nil {
 			return gerr.WithMessage(err, "put ip index")
 		}
+
+		if err = putMaxHostBits(bkt[BiMeta], &oRow); err != nil {
+			return gerr.WithMessage(err, "put meta")
+		}
 	}
 
 	return nil
 }
 
+// meta key of the largest row size, in host bits, of an address family & status
+func metaHostBitsKey(bIs6 bool, status string) []byte {
+	if bIs6 {
+		return []byte("hostbits-v6:" + status)
+	}
+	return []byte("hostbits-v4:" + status)
+}
+
+func putMaxHostBits(bktMeta *bbolt.Bucket, pR *Row) error {
+
+	span, ok := RowSpan(pR)
+	if !ok {
+		return nil
+	}
+	key := metaHostBitsKey(span.First.Is6(), string(pR.Status))
+	nBits := span.HostBits()
+	if bs := bktMeta.Get(key); (len(bs) == 1) && (int(bs[0]) >= nBits) {
+		return nil
+	}
+	return bktMeta.Put(key, []byte{byte(nBits)})
+}
+
+/*
+host bits of the largest row of an address family, among rows of the
+statuses in ss.  kept per status, so that huge reserved/available blocks
+do not widen walks over allocated/assigned rows.  the whole address
+space when the meta bucket is missing.
+*/
+func MaxHostBitsTx(tx *bbolt.Tx, bIs6 bool, ss StatusSet) int {
+
+	nMax := 32
+	if bIs6 {
+		nMax = 128
+	}
+	bkt := tx.Bucket(BiMeta.Key())
+	if bkt == nil {
+		return nMax
+	}
+
+	nBits := 0
+	for st := range ss {
+		if bs := bkt.Get(metaHostBitsKey(bIs6, st)); (len(bs) == 1) && (int(bs[0]) > nBits) {
+			nBits = min(int(bs[0]), nMax)
+		}
+	}
+	return nBits
+}
+
 type RowIndex []byte
 
 func GetRow(tx *bbolt.Tx, rowIx RowIndex) (Row, error) {
@@ -428,16 +551,52 @@ func AsnToRowTx(tx *bbolt.Tx, bsASN []byte) (Row, error) {
 	return GetRow(tx, rowIx)
 }
 
-func IpToRow(db *bbolt.DB, ip netip.Addr) (Row, error) {
+func IpToRow(db *bbolt.DB, ip netip.Addr, ss StatusSet) (Row, error) {
 	tx, err := db.Begin(false)
 	if err != nil {
 		return Row{}, err
 	}
 	defer tx.Rollback()
-	return IpToRowTx(tx, ip)
+	return IpToRowTx(tx, ip, ss)
+}
+
+/*
+most specific row of one IP index value holding ip, among rows of the
+statuses in ss.  rows of one value share their start, so the smallest.
+*/
+func rowAtIpKey(bktRows *bbolt.Bucket, v []byte, ip netip.Addr, ss StatusSet) (Row, bool, error) {
+
+	var ret Row
+	var spanRet IpSpan
+	bFound := false
+	for ; len(v) >= RowIxLen; v = v[RowIxLen:] {
+
+		bsRow := bktRows.Get(v[:RowIxLen])
+		if len(bsRow) == 0 {
+			return Row{}, false, ENotFound
+		}
+		if !ss.HasLine(bsRow) {
+			continue
+		}
+
+		row, err := ParseRow(bsRow)
+		if err != nil {
+			return Row{}, false, err
+		}
+		span, ok := RowSpan(&row)
+		if !ok || !row.HasIP(ip) {
+			continue
+		}
+		if !bFound || span.Last.Less(spanRet.Last) {
+			ret, spanRet, bFound = row, span, true
+		}
+	}
+
+	return ret, bFound, nil
 }
 
-func IpToRowTx(tx *bbolt.Tx, ip netip.Addr) (Row, error) {
+// most specific row holding ip, among rows of the statuses in ss
+func IpToRowTx(tx *bbolt.Tx, ip netip.Addr, ss StatusSet) (Row, error) {
 
 	if !ip.IsValid() {
 		return Row{}, EInvalidIpAddress
@@ -452,49 +611,178 @@ func IpToRowTx(tx *bbolt.Tx, ip netip.Addr) (Row, error) {
 	if err != nil {
 		return Row{}, err
 	}
+	bktRows, err := GetBucket(tx, BiRow.Key())
+	if err != nil {
+		return Row{}, err
+	}
 
-	// lookup row index by ip
-	binIpAddr := ip.AsSlice()
-	curBktIp := bktIp.Cursor()
-	k, v := curBktIp.Seek(binIpAddr)
-
-	tryReSeek := true
+	/*
+		the nearest key at or before ip may belong to a smaller row ending
+		before it, with larger rows further back still reaching it.  walk
+		back to where even the largest row could not, taking the first (i.e.
+		most specific) row holding ip.
+	*/
+	bsIp := ip.AsSlice()
+	bsFloor := reachFloor(ip, MaxHostBitsTx(tx, ip.Is6(), ss)).AsSlice()
 
-	// case: not found, or in last network range
+	cur := bktIp.Cursor()
+	k, v := cur.Seek(bsIp)
 	if k == nil {
-		// fetch row index of last network range
-		k, v = curBktIp.Last()
-		if k == nil {
-			return Row{}, ENotFound
+		k, v = cur.Last()
+	} else if !bytes.Equal(k, bsIp) {
+		k, v = cur.Prev()
+	}
+
+	for ; (k != nil) && (bytes.Compare(k, bsFloor) >= 0); k, v = cur.Prev() {
+
+		row, ok, err := rowAtIpKey(bktRows, v, ip, ss)
+		if err != nil {
+			return Row{}, err
+		}
+		if ok {
+			return row, nil
 		}
-		tryReSeek = false
 	}
 
-RESEEK:
+	return Row{}, ENotFound
+}
+
+// cursor steps tried before re-seeking, in batch lookups
+const BatchMaxSteps = 64
 
-	// get row data from row index
-	ret, err := GetRow(tx, v)
+// lookup of addresses outside of the row walked to (swapped in tests)
+var g_batchFallback = IpToRowTx
+
+func IpToRowBatch(db *bbolt.DB, sIPs []netip.Addr, ss StatusSet) ([]Row, []error) {
+	tx, err := db.Begin(false)
 	if err != nil {
-		return ret, err
+		sErr := make([]error, len(sIPs))
+		for ix := range sErr {
+			sErr[ix] = err
+		}
+		return make([]Row, len(sIPs)), sErr
 	}
+	defer tx.Rollback()
+	return IpToRowBatchTx(tx, sIPs, ss)
+}
+
+/*
+Lookup of many IPs in one pass.  Addresses are visited in sorted order,
+walking the v4/v6 index cursors forward (re-seeking only across long
+runs of keys), and re-using the current row while it still contains the
+next address.  Addresses outside of the row at the nearest key fall back
+to IpToRowTx, for rows reaching them from further back.  Results are
+parallel to sIPs.
+*/
+func IpToRowBatchTx(tx *bbolt.Tx, sIPs []netip.Addr, ss StatusSet) ([]Row, []error) {
 
-	// check for range membership
-	for j := range ret.IpRange {
-		if ret.IpRange[j].Contains(ip) {
-			return ret, nil
+	sRows := make([]Row, len(sIPs))
+	sErrs := make([]error, len(sIPs))
+
+	bktRows, err := GetBucket(tx, BiRow.Key())
+	if err != nil {
+		for ix := range sErrs {
+			sErrs[ix] = err
 		}
+		return sRows, sErrs
 	}
 
-	// backtrack once
-	if tryReSeek {
-		tryReSeek = false
-		k, v = curBktIp.Prev()
-		if k != nil {
-			goto RESEEK
+	sOrder := make([]int, 0, len(sIPs))
+	for ix := range sIPs {
+		if !sIPs[ix].IsValid() {
+			sErrs[ix] = EInvalidIpAddress
+			continue
 		}
+		sOrder = append(sOrder, ix)
 	}
+	sort.Slice(sOrder, func(i, j int) bool {
+		return sIPs[sOrder[i]].Less(sIPs[sOrder[j]])
+	})
 
-	return Row{}, ENotFound
+	var cur *bbolt.Cursor
+	var kCur, vCur, kNext, vNext []byte
+	var bIs6 bool
+	var row Row
+	var bRow bool
+
+	for ixOrder, ix := range sOrder {
+
+		ip := sIPs[ix]
+
+		// (re)open cursor on first address of each family
+		if (ixOrder == 0) || (ip.Is6() != bIs6) {
+
+			bIs6 = ip.Is6()
+			ipix := BiV4
+			if bIs6 {
+				ipix = BiV6
+			}
+			bktIp, err := GetBucket(tx, ipix.Key())
+			if err != nil {
+				sErrs[ix] = err
+				cur = nil
+				continue
+			}
+			cur = bktIp.Cursor()
+			kCur, vCur = nil, nil
+			kNext, vNext = cur.First()
+			bRow = false
+
+		} else if cur == nil {
+			sErrs[ix] = sErrs[sOrder[ixOrder-1]]
+			continue
+		}
+
+		// advance to the last key <= ip
+		bsIp := ip.AsSlice()
+		nSteps := 0
+		for (kNext != nil) && (bytes.Compare(kNext, bsIp) <= 0) {
+
+			if nSteps == BatchMaxSteps {
+
+				// long jump: seek, then settle on the preceding key
+				k, v := cur.Seek(bsIp)
+				if (k != nil) && bytes.Equal(k, bsIp) {
+					kCur, vCur = k, v
+					kNext, vNext = cur.Next()
+				} else if k == nil {
+					kCur, vCur = cur.Last()
+					kNext, vNext = nil, nil
+				} else {
+					kCur, vCur = cur.Prev()
+					kNext, vNext = cur.Next()
+				}
+				bRow = false
+				break
+			}
+
+			kCur, vCur = kNext, vNext
+			kNext, vNext = cur.Next()
+			bRow = false
+			nSteps += 1
+		}
+
+		if kCur == nil {
+			sErrs[ix] = ENotFound
+			continue
+		}
+
+		if !bRow {
+			if row, bRow, err = rowAtIpKey(bktRows, vCur, ip, ss); err != nil {
+				sErrs[ix] = err
+				continue
+			}
+		}
+
+		// outside of the rows at the nearest key: walk back over nested rows
+		if bRow && row.HasIP(ip) {
+			sRows[ix] = row
+		} else {
+			sRows[ix], sErrs[ix] = g_batchFallback(tx, ip, ss)
+		}
+	}
+
+	return sRows, sErrs
 }
 
 func FindAssociated(
@@ -507,6 +795,13 @@ func FindAssociated(
 		return nil, err
 	}
 	defer tx.Rollback()
+	return FindAssociatedTx(tx, bsRegistry, bsRegId, nil)
+}
+
+// rows sharing a reg-id, optionally pre-filtered by raw row data
+func FindAssociatedTx(
+	tx *bbolt.Tx, bsRegistry, bsRegId []byte, fnMatch func(bsRow []byte) bool,
+) ([]Row, error) {
 
 	// walk keys of id2ix[bsRegistry][bsRegId]
 	bktIdIx, err := GetBucket(tx, BiId2Ix.Key())
@@ -524,10 +819,22 @@ func FindAssociated(
 		return nil, nil
 	}
 
+	bktRows, err := GetBucket(tx, BiRow.Key())
+	if err != nil {
+		return nil, err
+	}
+
 	// rows
 	ret := make([]Row, 0)
 	err = bktId.ForEach(func(bsRowIx, _ []byte) error {
-		row, e2 := GetRow(tx, bsRowIx)
+		bsRow := bktRows.Get(bsRowIx)
+		if len(bsRow) == 0 {
+			return ENotFound
+		}
+		if (fnMatch != nil) && !fnMatch(bsRow) {
+			return nil
+		}
+		row, e2 := ParseRow(bsRow)
 		if e2 == nil {
 			ret = append(ret, row)
 		}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func writeGzLines(t *testing.T, fname string, sLines []string) {
+
+	pF, err := os.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pF.Close()
+
+	gzw := gzip.NewWriter(pF)
+	for _, line := range sLines {
+		fmt.Fprintln(gzw, line)
+	}
+	if err = gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// index built from delegation lines (registry|cc|type|start|value|date|status|reg-id)
+func newTestIndex(t *testing.T, sRows []string) *bbolt.DB {
+
+	dir := t.TempDir()
+	fDeleg := filepath.Join(dir, "delegated-test.txt.gz")
+	fAsn := filepath.Join(dir, "asn.txt.gz")
+
+	sLines := append([]string{"2|test|20240101|1|19700101|20240101|+0000"}, sRows...)
+	writeGzLines(t, fDeleg, sLines)
+	writeGzLines(t, fAsn, []string{"64496 TEST-AS, ZZ"})
+
+	m := &Modes{Statuses: DefaultStatusSet()}
+	db, _, err := m.OpenIndex(filepath.Join(dir, "test.db"), true, []string{fDeleg}, fAsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+/*
+v4: 300 /24s in 10.0.0.0/15, every other one missing, so that walks over
+them exceed BatchMaxSteps; a /16, a lone /32 & a last /24.  v6: 100 /48s in
+2001:db8::/32, every other one missing.
+*/
+func batchTestRows() []string {
+
+	var ret []string
+	for ix := 0; ix < 600; ix += 2 {
+		ret = append(ret, fmt.Sprintf("arin|US|ipv4|10.%d.%d.0|256|20000101|allocated|ORG-%d", ix/256, ix%256, ix))
+	}
+	ret = append(ret,
+		"ripencc|NL|ipv4|20.0.0.0|65536|20000101|assigned|ORG-B16",
+		"apnic|AU|ipv4|203.0.113.7|1|20000101|assigned|ORG-HOST",
+		"afrinic|ZA|ipv4|223.0.0.0|256|20000101|allocated|ORG-LAST",
+	)
+	for ix := 0; ix < 100; ix += 2 {
+		ret = append(ret, fmt.Sprintf("lacnic|BR|ipv6|2001:db8:%x::|48|20000101|allocated|ORG-V6-%d", ix, ix))
+	}
+	return ret
+}
+
+// edges & gaps, most far enough apart for a long jump
+func batchTestAddrs() []netip.Addr {
+
+	var ret []netip.Addr
+	for _, sz := range []string{
+		"0.0.0.0", "9.255.255.255", "10.0.0.0", "10.0.0.255", "10.0.1.1",
+		"10.0.2.128", "10.0.200.1", "10.1.87.5", "10.2.87.1", "10.2.88.1",
+		"19.255.255.255", "20.0.0.0", "20.0.255.255", "20.1.0.0",
+		"203.0.113.6", "203.0.113.7", "203.0.113.8", "223.0.0.0",
+		"223.0.0.255", "223.0.1.0", "255.255.255.255",
+		"::", "2001:db7:ffff::1", "2001:db8::", "2001:db8:1::1",
+		"2001:db8:2:ffff::", "2001:db8:62::1", "2001:db8:ffff::1",
+		"::ffff:10.0.0.1", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+	} {
+		ret = append(ret, netip.MustParseAddr(sz))
+	}
+	return ret
+}
+
+// every nth /24 of 10.0.0.0/15, both rows & gaps
+func batchTestDense(n int) []netip.Addr {
+
+	var ret []netip.Addr
+	for ix := 0; ix < 600; ix += n {
+		ret = append(ret, netip.AddrFrom4([4]byte{10, byte(ix / 256), byte(ix % 256), 9}))
+	}
+	return ret
+}
+
+func TestIpToRowBatchTx(t *testing.T) {
+
+	db := newTestIndex(t, batchTestRows())
+	sAll := batchTestAddrs()
+
+	var sV4, sV6 []netip.Addr
+	for _, ip := range sAll {
+		if ip.Is4() {
+			sV4 = append(sV4, ip)
+		} else {
+			sV6 = append(sV6, ip)
+		}
+	}
+
+	fnSorted := func(sIn []netip.Addr) []netip.Addr {
+		ret := append([]netip.Addr(nil), sIn...)
+		sort.Slice(ret, func(i, j int) bool { return ret[i].Less(ret[j]) })
+		return ret
+	}
+	fnShuffled := func(sIn []netip.Addr, seed int64) []netip.Addr {
+		ret := append([]netip.Addr(nil), sIn...)
+		rand.New(rand.NewSource(seed)).Shuffle(len(ret), func(i, j int) { ret[i], ret[j] = ret[j], ret[i] })
+		return ret
+	}
+
+	tests := []struct {
+		name string
+		ips  []netip.Addr
+	}{
+		{"empty", nil},
+		{"single", []netip.Addr{netip.MustParseAddr("10.0.2.1")}},
+		{"sorted v4", fnSorted(sV4)},
+		{"sorted v6", fnSorted(sV6)},
+		{"sorted mixed", fnSorted(sAll)},
+		{"unsorted v4", fnShuffled(sV4, 1)},
+		{"unsorted mixed", fnShuffled(sAll, 2)},
+		{"unsorted mixed 2", fnShuffled(sAll, 3)},
+		{"duplicates", append(fnShuffled(sAll, 4), sAll...)},
+		{"invalid", []netip.Addr{{}, netip.MustParseAddr("10.0.0.1"), {}}},
+		{"dense", batchTestDense(3)},
+		{"dense unsorted", fnShuffled(batchTestDense(7), 5)},
+		{"dense & sparse", fnShuffled(append(batchTestDense(5), sAll...), 6)},
+		{"jump from below first", fnSorted(append(batchTestDense(140), netip.MustParseAddr("9.0.0.1")))},
+		{"jump past last key", []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("223.0.0.9")}},
+		{"jump to exact key", []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.1.0.0"), netip.MustParseAddr("10.1.2.5"), netip.MustParseAddr("10.2.82.0")}},
+	}
+
+	// gaps between rows reach the fallback
+	nFallback := 0
+
+	/*
+		rows do not overlap, so a walk that settles on the right key only
+		falls back to a single lookup for addresses outside of every row
+	*/
+	mFallback := make(map[netip.Addr]bool)
+	g_batchFallback = func(tx *bbolt.Tx, ip netip.Addr, ss StatusSet) (Row, error) {
+		mFallback[ip] = true
+		return IpToRowTx(tx, ip, ss)
+	}
+	defer func() { g_batchFallback = IpToRowTx }()
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		for _, tc := range tests {
+			clear(mFallback)
+			sRows, sErrs := IpToRowBatchTx(tx, tc.ips, DefaultStatusSet())
+			if (len(sRows) != len(tc.ips)) || (len(sErrs) != len(tc.ips)) {
+				t.Fatalf("%s: %d rows, %d errors for %d addresses", tc.name, len(sRows), len(sErrs), len(tc.ips))
+			}
+			for ix, ip := range tc.ips {
+				row, err := IpToRowTx(tx, ip, DefaultStatusSet())
+				if err != sErrs[ix] {
+					t.Errorf("%s: %s: error %v, want %v", tc.name, ip, sErrs[ix], err)
+					continue
+				}
+				if !reflect.DeepEqual(row, sRows[ix]) {
+					t.Errorf("%s: %s: row %v, want %v", tc.name, ip, sRows[ix], row)
+				}
+				if mFallback[ip] {
+					nFallback += 1
+				}
+				if mFallback[ip] && (err == nil) {
+					t.Errorf("%s: %s: fell back to single lookup", tc.name, ip)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nFallback == 0 {
+		t.Error("no lookups fell back to IpToRowTx")
+	}
+}
+
+// rows nested in larger ones, reached past smaller rows in between
+func TestIpToRowNested(t *testing.T) {
+
+	db := newTestIndex(t, overlapTestRows())
+
+	// start of the most specific row holding ip, empty when none:
+	// of the default statuses, & of all statuses
+	tests := []struct {
+		ip, start, startAll string
+	}{
+		{"10.0.0.0", "10.0.0.0", "10.0.0.0"},
+		{"10.5.0.7", "10.5.0.0", "10.5.0.0"},
+		{"10.5.1.0", "10.0.0.0", "10.0.0.0"},
+		{"10.6.0.1", "10.0.0.0", "10.6.0.0"},
+		{"10.9.0.1", "10.0.0.0", "10.0.0.0"},
+		{"10.100.0.1", "10.0.0.0", "10.0.0.0"},
+		{"10.200.5.5", "10.200.0.0", "10.200.0.0"},
+		{"10.201.0.0", "10.0.0.0", "10.0.0.0"},
+		{"10.255.255.255", "10.0.0.0", "10.0.0.0"},
+		{"11.0.0.5", "11.0.0.0", "11.0.0.0"},
+		{"11.0.1.0", "", ""},
+		{"9.255.255.255", "", ""},
+		{"2001:db8:2::1", "2001:DB8::", "2001:DB8::"},
+		{"2001:db8:1:5::1", "2001:DB8:1::", "2001:DB8:1::"},
+		{"2001:db8:ffff:ffff::1", "2001:DB8::", "2001:DB8::"},
+		{"2001:db9::1", "2001:DB9::", "2001:DB9::"},
+		{"2001:db9:1::1", "", ""},
+	}
+
+	var sIPs []netip.Addr
+	for _, tc := range tests {
+		sIPs = append(sIPs, netip.MustParseAddr(tc.ip))
+	}
+
+	// shuffled, so that batch walks run both over & around nested rows
+	sShuffled := append([]netip.Addr(nil), sIPs...)
+	sPerm := rand.New(rand.NewSource(1)).Perm(len(sIPs))
+	for ix, ixFrom := range sPerm {
+		sShuffled[ix] = sIPs[ixFrom]
+	}
+
+	for _, bAll := range []bool{false, true} {
+
+		ss := DefaultStatusSet()
+		if bAll {
+			ss = AllStatusSet()
+		}
+		fnWant := func(ix int) string {
+			if bAll {
+				return tests[ix].startAll
+			}
+			return tests[ix].start
+		}
+
+		sBatch, sBatchErrs := IpToRowBatch(db, sShuffled, ss)
+		sGot := make([]Row, len(sIPs))
+		sGotErrs := make([]error, len(sIPs))
+		for ix, ixFrom := range sPerm {
+			sGot[ixFrom], sGotErrs[ixFrom] = sBatch[ix], sBatchErrs[ix]
+		}
+
+		for ix, ip := range sIPs {
+
+			row, err := IpToRow(db, ip, ss)
+			checkRowStart(t, fmt.Sprintf("single %s (all %v)", ip, bAll), row, err, fnWant(ix))
+
+			if sRows, err := (CmdIP{IP: ip}).Rows(db, ss); err == nil {
+				row = sRows[0]
+			} else {
+				row = Row{}
+			}
+			checkRowStart(t, fmt.Sprintf("ip %s (all %v)", ip, bAll), row, err, fnWant(ix))
+
+			checkRowStart(t, fmt.Sprintf("batch %s (all %v)", ip, bAll), sGot[ix], sGotErrs[ix], fnWant(ix))
+		}
+	}
+}
+
+// row starting at 'want', or ENotFound when empty
+func checkRowStart(t *testing.T, name string, row Row, err error, want string) {
+	t.Helper()
+	if len(want) == 0 {
+		if err != ENotFound {
+			t.Errorf("%s: got %s, %v, want not found", name, row.Start, err)
+		}
+	} else if (err != nil) || (string(row.Start) != want) {
+		t.Errorf("%s: got %s, %v, want %s", name, row.Start, err, want)
+	}
+}
+
+/*
+rows sharing a start address are all indexed, & huge blocks of other
+statuses do not widen walks over delegated rows
+*/
+func TestIpIndexSharedStart(t *testing.T) {
+
+	db := newTestIndex(t, []string{
+		"arin|US|ipv4|172.16.0.0|65536|20000101|reserved|",
+		"arin|US|ipv4|172.16.0.0|256|20000101|allocated|ORG-A",
+		"arin|US|ipv4|172.16.5.0|256|20000101|assigned|ORG-B",
+		"apnic|ZZ|ipv6|2000::|3|20000101|available|",
+		"apnic|AU|ipv6|2001:db8::|32|20000101|allocated|ORG-V6",
+	})
+	ssReserved := StatusSet{"RESERVED": true}
+
+	tests := []struct {
+		ss     StatusSet
+		ip     string
+		regId  string
+		nValue string // of the row found, empty when none
+	}{
+		{DefaultStatusSet(), "172.16.0.1", "ORG-A", "256"},
+		{DefaultStatusSet(), "172.16.5.1", "ORG-B", "256"},
+		{DefaultStatusSet(), "172.16.9.9", "", ""},
+		{AllStatusSet(), "172.16.0.1", "ORG-A", "256"},
+		{AllStatusSet(), "172.16.9.9", "", "65536"},
+		{ssReserved, "172.16.0.1", "", "65536"},
+		{ssReserved, "172.16.5.1", "", "65536"},
+		{DefaultStatusSet(), "2001:db8:5::1", "ORG-V6", "32"},
+		{DefaultStatusSet(), "2001:db9::1", "", ""},
+		{AllStatusSet(), "2001:db9::1", "", "3"},
+	}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+
+		for _, tc := range tests {
+
+			ip := netip.MustParseAddr(tc.ip)
+			row, err := IpToRowTx(tx, ip, tc.ss)
+			sRows, sErrs := IpToRowBatchTx(tx, []netip.Addr{ip}, tc.ss)
+			for ix, got := range []struct {
+				row Row
+				err error
+			}{{row, err}, {sRows[0], sErrs[0]}} {
+				if len(tc.nValue) == 0 {
+					if got.err != ENotFound {
+						t.Errorf("%d: %s %v: got %s, %v, want not found", ix, tc.ip, tc.ss, got.row.Line(), got.err)
+					}
+				} else if (got.err != nil) || (string(got.row.RegId) != tc.regId) || (string(got.row.Value) != tc.nValue) {
+					t.Errorf("%d: %s %v: got %s, %v, want %s of %s", ix, tc.ip, tc.ss, got.row.Line(), got.err, tc.regId, tc.nValue)
+				}
+			}
+		}
+
+		// per-status maxima
+		if n := MaxHostBitsTx(tx, true, DefaultStatusSet()); n != 96 {
+			t.Errorf("v6 delegated host bits %d, want 96", n)
+		}
+		if n := MaxHostBitsTx(tx, true, AllStatusSet()); n != 125 {
+			t.Errorf("v6 host bits %d, want 125", n)
+		}
+		if n := MaxHostBitsTx(tx, false, ssReserved); n != 16 {
+			t.Errorf("v4 reserved host bits %d, want 16", n)
+		}
+		if n := MaxHostBitsTx(tx, false, DefaultStatusSet()); n != 8 {
+			t.Errorf("v4 delegated host bits %d, want 8", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every row of a shared start is listed
+	for _, tc := range []struct {
+		ss    StatusSet
+		nRows int
+	}{{DefaultStatusSet(), 2}, {AllStatusSet(), 3}, {ssReserved, 1}} {
+		sRows, err := (CmdNet{Prefix: netip.MustParsePrefix("172.16.0.0/16")}).Rows(db, tc.ss)
+		if (err != nil) || (len(sRows) != tc.nRows) {
+			t.Errorf("net %v: got %d rows, %v, want %d", tc.ss, len(sRows), err, tc.nRows)
+		}
+	}
+}
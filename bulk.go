@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+
+	cw "github.com/BourgeoisBear/nicsearch/colwriter"
+	"go.etcd.io/bbolt"
+)
+
+// input lines per unit of work (and per read transaction)
+const BulkChunkLen = 1024
+
+type bulkLine struct {
+	Query string
+	IP    netip.Addr // valid for IP lookups
+	ASN   uint32
+	Out   []byte
+	Err   error
+}
+
+type bulkChunk struct {
+	Seq   int
+	Lines []bulkLine
+}
+
+func (m *Modes) bulkWriter() cw.RowWriter {
+	writerCfg := cw.Cfg{Spacer: "|", Pad: m.Pretty}
+	return writerCfg.NewWriterFuncs([]cw.ColCfg{
+		cw.ColCfg{Wid: 39, Title: "QRY"},
+		cw.ColCfg{Wid: 9, Title: "RIR"},
+		cw.ColCfg{Wid: 3, Title: "CC"},
+		cw.ColCfg{Wid: 4, Title: "TYPE"},
+		cw.ColCfg{Wid: 23, Title: "RESOURCE", Rt: true},
+		cw.ColCfg{Wid: 10, Title: "DATE"},
+		cw.ColCfg{Wid: 10, Title: "STS"},
+		cw.ColCfg{Title: "NAME"},
+	})
+}
+
+// bare IP or ASN of a bulk input line
+func (m *Modes) parseBulkLine(pL *bulkLine) {
+
+	iCmd, err := m.detectCmd(strings.ToUpper(pL.Query))
+	if err != nil {
+		pL.Err = err
+		return
+	}
+
+	switch v := iCmd.(type) {
+	case CmdIP:
+		pL.IP = v.IP
+	case CmdASN:
+		pL.ASN = v.ASN
+	default:
+		pL.Err = fmt.Errorf("bulk mode only accepts IP addresses & ASNs")
+	}
+}
+
+// lookup & format all lines of a chunk inside of one read transaction
+func (m *Modes) bulkLookupTx(tx *bbolt.Tx, oWF cw.RowWriter, sLines []bulkLine) error {
+
+	var sIPs []netip.Addr
+	var sIxIP []int
+	for ix := range sLines {
+		pL := &sLines[ix]
+		if m.parseBulkLine(pL); (pL.Err == nil) && pL.IP.IsValid() {
+			sIPs = append(sIPs, pL.IP)
+			sIxIP = append(sIxIP, ix)
+		}
+	}
+
+	// IPs in one sorted pass
+	sRowsIP, sErrsIP := IpToRowBatchTx(tx, sIPs, m.Statuses)
+	ixIP := 0
+
+	var buf bytes.Buffer
+	for ix := range sLines {
+
+		pL := &sLines[ix]
+		if pL.Err != nil {
+			continue
+		}
+
+		var row Row
+		var err error
+		if (ixIP < len(sIxIP)) && (sIxIP[ixIP] == ix) {
+			row, err = sRowsIP[ixIP], sErrsIP[ixIP]
+			ixIP += 1
+		} else {
+			bsASN := Uint32ToBytes(pL.ASN)
+			row, err = AsnToRowTx(tx, bsASN[:])
+		}
+
+		// ASN rows are looked up regardless of status
+		if err == nil && !m.Statuses.Has(row.Status) {
+			err = ENotFound
+		}
+		if err != nil {
+			if (err != ENotFound) && (err != EInvalidIpAddress) {
+				return err
+			}
+			pL.Err = err
+			continue
+		}
+
+		buf.Reset()
+		if err = m.writeBulkRow(tx, oWF, &buf, pL, &row); err != nil {
+			return err
+		}
+		pL.Out = Clone(buf.Bytes())
+	}
+
+	return nil
+}
+
+func (m *Modes) writeBulkRow(
+	tx *bbolt.Tx, oWF cw.RowWriter, iWri io.Writer, pL *bulkLine, pR *Row,
+) error {
+
+	var szResource string
+	var bsName []byte
+
+	if pR.IsType(TkASN) {
+		szResource = "AS" + FormatASN(pL.ASN, m.AsDot)
+		bsASN := Uint32ToBytes(pL.ASN)
+		bsName, _ = AsnToNameTx(tx, bsASN[:])
+	} else {
+		for _, pfx := range pR.IpRange {
+			if pfx.Contains(pL.IP) {
+				szResource = pfx.String()
+				break
+			}
+		}
+	}
+
+	_, err := oWF(iWri,
+		pL.Query,
+		pR.Registry,
+		pR.Cc,
+		pR.Type,
+		szResource,
+		m.fmtDate(pR.Date),
+		pR.Status,
+		bsName,
+	)
+	return err
+}
+
+/*
+Lookup one IP or ASN per line of iRd, over nWorkers concurrent read
+transactions.  Results are written to stdout (& errors to stderr) in
+input order.
+*/
+func (m *Modes) RunBulk(db *bbolt.DB, iRd io.Reader, nWorkers int) error {
+
+	if nWorkers < 1 {
+		nWorkers = 1
+	}
+
+	chIn := make(chan bulkChunk, nWorkers)
+	chOut := make(chan bulkChunk, nWorkers)
+
+	// bounds chunks held in memory while waiting on a slow one
+	chSlots := make(chan struct{}, nWorkers*4)
+
+	var errWorker error
+	var onceErr sync.Once
+
+	// workers
+	var wg sync.WaitGroup
+	for ix := 0; ix < nWorkers; ix++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			oWF := m.bulkWriter()
+			for chunk := range chIn {
+				err := db.View(func(tx *bbolt.Tx) error {
+					return m.bulkLookupTx(tx, oWF, chunk.Lines)
+				})
+				if err != nil {
+					onceErr.Do(func() { errWorker = err })
+
+					// lines not reached before the failure
+					for ix := range chunk.Lines {
+						pL := &chunk.Lines[ix]
+						if (pL.Out == nil) && (pL.Err == nil) {
+							pL.Err = err
+						}
+					}
+				}
+				chOut <- chunk
+			}
+		}()
+	}
+
+	// reader
+	var errRead error
+	go func() {
+
+		defer close(chIn)
+
+		sc := bufio.NewScanner(iRd)
+		seq := 0
+		sLines := make([]bulkLine, 0, BulkChunkLen)
+		fnSend := func() {
+			chSlots <- struct{}{}
+			chIn <- bulkChunk{Seq: seq, Lines: sLines}
+			seq += 1
+			sLines = make([]bulkLine, 0, BulkChunkLen)
+		}
+
+		for sc.Scan() {
+			sz := strings.TrimSpace(sc.Text())
+			if (len(sz) == 0) || strings.HasPrefix(sz, "#") {
+				continue
+			}
+			sLines = append(sLines, bulkLine{Query: sz})
+			if len(sLines) == BulkChunkLen {
+				fnSend()
+			}
+		}
+		if len(sLines) > 0 {
+			fnSend()
+		}
+		errRead = sc.Err()
+	}()
+
+	go func() {
+		wg.Wait()
+		close(chOut)
+	}()
+
+	// errors always name their input line
+	mErr := *m
+	mErr.PrependQuery = true
+
+	// re-order & write
+	bw := bufio.NewWriter(os.Stdout)
+	mPending := make(map[int]bulkChunk)
+	seqNext := 0
+	for chunk := range chOut {
+
+		mPending[chunk.Seq] = chunk
+		for {
+			next, ok := mPending[seqNext]
+			if !ok {
+				break
+			}
+			delete(mPending, seqNext)
+			seqNext += 1
+
+			for ix := range next.Lines {
+				pL := &next.Lines[ix]
+				if pL.Err != nil {
+					bw.Flush()
+					mErr.printErr(pL.Err, pL.Query)
+					continue
+				}
+				if _, err := bw.Write(pL.Out); err != nil {
+					return err
+				}
+			}
+			<-chSlots
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if errRead != nil {
+		return errRead
+	}
+	return errWorker
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestRunBulkOrder(t *testing.T) {
+
+	db := newTestIndex(t, []string{
+		"arin|US|ipv4|10.0.0.0|16777216|20000101|allocated|ORG-A",
+		"arin|US|ipv4|11.0.0.0|256|20000101|reserved|",
+		"arin|US|asn|64512|1|20000101|assigned|ORG-A",
+	})
+
+	// several chunks, the last partial, with ASNs & failures interleaved
+	var sb strings.Builder
+	var sWantOut, sWantErr []string
+
+	// first chunk finishes last
+	ipSlow := netip.MustParseAddr("11.0.0.255")
+	sb.WriteString(ipSlow.String() + "\n")
+	sWantErr = append(sWantErr, ipSlow.String())
+	g_batchFallback = func(tx *bbolt.Tx, ip netip.Addr, ss StatusSet) (Row, error) {
+		if ip == ipSlow {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return IpToRowTx(tx, ip, ss)
+	}
+	defer func() { g_batchFallback = IpToRowTx }()
+
+	for ix := 0; ix < 3*BulkChunkLen+17; ix++ {
+
+		var sz string
+		switch {
+		case ix%13 == 0:
+			sz = fmt.Sprintf("BOGUS-%d", ix)
+			sWantErr = append(sWantErr, sz)
+		case ix%11 == 0:
+			sz = fmt.Sprintf("11.0.0.%d", ix%255) // reserved: not found
+			sWantErr = append(sWantErr, sz)
+		case ix%7 == 0:
+			sz = "AS64512"
+			sWantOut = append(sWantOut, sz)
+		default:
+			sz = fmt.Sprintf("10.%d.%d.%d", ix>>16, (ix>>8)&0xFF, ix&0xFF)
+			sWantOut = append(sWantOut, sz)
+		}
+		sb.WriteString(sz + "\n")
+		if ix%500 == 0 {
+			sb.WriteString("# comment\n\n")
+		}
+	}
+
+	m := &Modes{Statuses: DefaultStatusSet()}
+
+	var szOut string
+	szErr := captureStderr(t, func() {
+		szOut = captureFile(t, &os.Stdout, func() {
+			if err := m.RunBulk(db, strings.NewReader(sb.String()), 8); err != nil {
+				t.Error(err)
+			}
+		})
+	})
+
+	var sGotOut []string
+	for _, line := range strings.Split(strings.TrimSpace(szOut), "\n") {
+		sGotOut = append(sGotOut, strings.SplitN(line, "|", 2)[0])
+	}
+	if !reflect.DeepEqual(sGotOut, sWantOut) {
+		t.Errorf("stdout out of input order (%d lines, want %d)", len(sGotOut), len(sWantOut))
+	}
+
+	sGotErr := regexp.MustCompile(`BOGUS-[0-9]+|11\.0\.0\.[0-9]+`).FindAllString(szErr, -1)
+	if !reflect.DeepEqual(sGotErr, sWantErr) {
+		t.Errorf("stderr out of input order (%d lines, want %d)", len(sGotErr), len(sWantErr))
+	}
+}
@@ -2,11 +2,11 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/netip"
 	"os"
-	"strconv"
 	"strings"
 
 	cw "github.com/BourgeoisBear/nicsearch/colwriter"
@@ -21,6 +21,7 @@ type CmdExec interface {
 
 type CmdExecParams struct {
 	Modes
+	Ctx       context.Context
 	Db        *bbolt.DB
 	Cmd       string
 	MaxCmdLen uint16
@@ -67,28 +68,26 @@ func (cep CmdExecParams) getRowWriters() RowWriters {
 	}
 }
 
+// YYYYMMDD as YYYY-MM-DD in pretty mode
+func (m *Modes) fmtDate(in []byte) []byte {
+	if !m.Pretty || (len(in) < 8) {
+		return in
+	}
+	return bytes.Join([][]byte{in[:4], in[4:6], in[6:]}, []byte{'-'})
+}
+
 func (cep CmdExecParams) printRow(rw RowWriters, pR *Row) error {
 
 	if pR == nil {
 		return nil
 	}
 
-	fmtDate := func(in []byte) []byte {
-		if !cep.Pretty || (len(in) < 8) {
-			return in
-		}
-		return bytes.Join([][]byte{in[:4], in[4:6], in[6:]}, []byte{'-'})
-	}
-
 	if pR.IsType(TkASN) {
 
-		szAsnFirst := strconv.FormatInt(int64(pR.ASN), 10)
+		szAsnFirst := FormatASN(pR.ASN, cep.AsDot)
 		szAsnLast := ""
 		if pR.ValueInt > 1 {
-			szAsnLast = strconv.FormatInt(
-				int64(pR.ASN)+int64(pR.ValueInt)-1,
-				10,
-			)
+			szAsnLast = FormatASN(pR.ASN+uint32(pR.ValueInt-1), cep.AsDot)
 		}
 
 		sFields := make([]interface{}, 0, 9)
@@ -102,7 +101,7 @@ func (cep CmdExecParams) printRow(rw RowWriters, pR *Row) error {
 			pR.Type,
 			szAsnFirst,
 			szAsnLast,
-			fmtDate(pR.Date),
+			cep.fmtDate(pR.Date),
 			pR.Status,
 			pR.AsName,
 		)
@@ -128,7 +127,7 @@ func (cep CmdExecParams) printRow(rw RowWriters, pR *Row) error {
 			pR.Cc,
 			pR.Type,
 			r.String(),
-			fmtDate(pR.Date),
+			cep.fmtDate(pR.Date),
 			pR.Status,
 		)
 
@@ -185,45 +184,132 @@ func (cep CmdExecParams) printRowsSorted(rw RowWriters, sRows []Row) error {
 	return nil
 }
 
-func (cep CmdExecParams) printRowAssoc(rw RowWriters, pR *Row, bAssoc bool) error {
+/*
+commands whose results can be collected as rows (e.g. for watchlists).
+statuses steer lookups towards rows of those statuses; listRows filters
+what is returned.
+*/
+type RowLister interface {
+	Rows(db *bbolt.DB, ss StatusSet) ([]Row, error)
+}
+
+// rows from a RowLister, limited to reported statuses
+func (m *Modes) listRows(db *bbolt.DB, iLister RowLister) ([]Row, error) {
+
+	sRows, err := iLister.Rows(db, m.Statuses)
+	if err != nil {
+		return nil, err
+	}
+
+	// CmdStatus picks its own statuses
+	if _, ok := iLister.(CmdStatus); !ok {
+		sRows = m.Statuses.Filter(sRows)
+	}
 
-	sRows := []Row{*pR}
+	if len(sRows) == 0 {
+		return nil, ENotFound
+	}
+	return sRows, nil
+}
+
+func rowAssoc(db *bbolt.DB, row Row, bAssoc bool) ([]Row, error) {
 	if bAssoc {
-		var err error
-		sRows, err = FindAssociated(cep.Db, pR.Registry, pR.RegId)
-		if err != nil {
+		return FindAssociated(db, row.Registry, row.RegId)
+	}
+	return []Row{row}, nil
+}
+
+func (v CmdIP) Rows(db *bbolt.DB, ss StatusSet) ([]Row, error) {
+
+	row, err := IpToRow(db, v.IP, ss)
+	if err != nil {
+		return nil, err
+	}
+	return rowAssoc(db, row, v.Assoc)
+}
+
+func (v CmdIP) Exec(cep CmdExecParams) error {
+
+	errIP := cep.printIP(v)
+
+	// also lookup IPv4 addresses embedded in IPv6 transition addresses
+	for _, emb := range EmbeddedV4Of(v.IP) {
+
+		cep.AnsiMsgEx(
+			os.Stderr, "EMBEDDED", emb.Mechanism+" "+emb.IP.String(),
+			cep.Cmd, []uint8{1, 96},
+		)
+
+		err := cep.printIP(CmdIP{IP: emb.IP, Assoc: v.Assoc})
+		if err == nil {
+			if errIP == ENotFound {
+				errIP = nil
+			}
+		} else if err != ENotFound {
 			return err
 		}
 	}
-	return cep.printRowsSorted(rw, sRows)
+
+	return errIP
 }
 
-func (v CmdIP) Exec(cep CmdExecParams) error {
+func (cep CmdExecParams) printIP(v CmdIP) error {
 
-	if row, err := IpToRow(cep.Db, v.IP); err != nil {
+	// report special-purpose blocks, in addition to any delegations
+	sb, bSpecial := SpecialBlockOf(v.IP)
+	if bSpecial {
+		if err := cep.printSpecialBlock(sb); err != nil {
+			return err
+		}
+	}
+
+	sRows, err := cep.listRows(cep.Db, v)
+	if err != nil {
+		if bSpecial && (err == ENotFound) {
+			return nil
+		}
 		return err
-	} else {
-		return cep.printRowAssoc(cep.getRowWriters(), &row, v.Assoc)
 	}
+	return cep.printRowsSorted(cep.getRowWriters(), sRows)
+}
+
+func (v CmdASN) Rows(db *bbolt.DB, _ StatusSet) ([]Row, error) {
+
+	row, err := AsnToRow(db, v.ASN)
+	if err != nil {
+		return nil, err
+	}
+	return rowAssoc(db, row, v.Assoc)
 }
 
 func (v CmdASN) Exec(cep CmdExecParams) error {
 
-	if row, err := AsnToRow(cep.Db, v.ASN); err != nil {
+	// explain special-purpose ASNs, in addition to any delegations
+	sa, bSpecial := SpecialAsnOf(v.ASN)
+	if bSpecial {
+		if err := cep.printSpecialAsn(sa); err != nil {
+			return err
+		}
+	}
+
+	sRows, err := cep.listRows(cep.Db, v)
+	if err != nil {
+		if bSpecial && (err == ENotFound) {
+			return nil
+		}
 		return err
-	} else {
-		return cep.printRowAssoc(cep.getRowWriters(), &row, v.Assoc)
 	}
+	return cep.printRowsSorted(cep.getRowWriters(), sRows)
 }
 
-func (v CmdAsName) Exec(cep CmdExecParams) error {
+func (v CmdAsName) Rows(db *bbolt.DB, _ StatusSet) ([]Row, error) {
 
-	sRows, err := NameRegexToASNs(cep.Db, v.Name)
+	sRows, err := NameRegexToASNs(db, v.Name)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if len(sRows) == 0 {
-		return ENotFound
+		return nil, ENotFound
 	}
 	if v.Assoc {
 		// get unique reg-id keypairs
@@ -233,30 +319,210 @@ func (v CmdAsName) Exec(cep CmdExecParams) error {
 		sRows = nil
 		for _, k := range sKeys {
 			pr := byRegId[k]
-			sTmp, err := FindAssociated(cep.Db, pr.Registry, pr.RegId)
+			sTmp, err := FindAssociated(db, pr.Registry, pr.RegId)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			sRows = append(sRows, sTmp...)
 		}
 	}
 
+	return sRows, nil
+}
+
+func (v CmdAsName) Exec(cep CmdExecParams) error {
+
+	sRows, err := cep.listRows(cep.Db, v)
+	if err != nil {
+		return err
+	}
+
 	// print collection
 	return cep.printRowsSorted(cep.getRowWriters(), sRows)
 }
 
 func (v CmdRDAP_IP) Exec(cep CmdExecParams) error {
 
-	bsJSON, err := rdap.QueryByIP(v.RIR, v.IP)
+	var bsJSON []byte
+	var err error
+	if v.RIR == rdap.RkMAX {
+		bsJSON, err = cep.rdapByIp(cep.Ctx, cep.Db, v.IP)
+	} else {
+		bsJSON, err = cep.rdapGetIP(cep.Ctx, cep.Rdap.BaseUrl(v.RIR), v.IP)
+	}
 	if err != nil {
 		return err
 	}
 	return cep.PrintJSON(os.Stdout, bsJSON)
 }
 
+func (v CmdRDAP_AS) Exec(cep CmdExecParams) error {
+
+	base, err := cep.rdapBaseForASN(cep.Ctx, cep.Db, v.ASN)
+	if err != nil {
+		return err
+	}
+	bsJSON, err := cep.rdapGet(cep.Ctx, rdap.ASNUrl(base, v.ASN))
+	if err != nil {
+		return err
+	}
+
+	if !v.Table {
+		return cep.PrintJSON(os.Stdout, bsJSON)
+	}
+
+	var aut rdap.Autnum
+	if err = cep.Rdap.Decode(bsJSON, &aut); err != nil {
+		os.Stderr.Write(bsJSON)
+		return err
+	}
+
+	writerCfg := cw.Cfg{Spacer: "|", Pad: cep.Pretty}
+	ccfgAut := []cw.ColCfg{
+		cw.ColCfg{Wid: 16, Title: "HANDLE"},
+		cw.ColCfg{Wid: 24, Title: "NAME"},
+		cw.ColCfg{Wid: 3, Title: "CC"},
+		cw.ColCfg{Wid: 10, Title: "STS"},
+		cw.ColCfg{Wid: 10, Title: "FROM", Rt: true},
+		cw.ColCfg{Title: "TO"},
+	}
+	ccfgContact := []cw.ColCfg{
+		cw.ColCfg{Wid: 16, Title: "ROLE"},
+		cw.ColCfg{Wid: 24, Title: "HANDLE"},
+		cw.ColCfg{Wid: 32, Title: "NAME"},
+		cw.ColCfg{Title: "EMAIL"},
+	}
+	if cep.PrependQuery {
+		ccQuery := cw.ColCfg{Wid: cep.MaxCmdLen}
+		ccfgAut = append([]cw.ColCfg{ccQuery}, ccfgAut...)
+		ccfgContact = append([]cw.ColCfg{ccQuery}, ccfgContact...)
+	}
+	oWfAut := writerCfg.NewWriterFuncs(ccfgAut)
+	oWfContact := writerCfg.NewWriterFuncs(ccfgContact)
+
+	fnAsn := func(pN *uint32) string {
+		if pN == nil {
+			return ""
+		}
+		return FormatASN(*pN, cep.AsDot)
+	}
+
+	parts := []interface{}{
+		aut.Handle,
+		aut.Name,
+		aut.Country,
+		strings.ToUpper(strings.Join(aut.Status, ":")),
+		fnAsn(aut.StartAutnum),
+		fnAsn(aut.EndAutnum),
+	}
+	if cep.PrependQuery {
+		parts = append([]interface{}{cep.Cmd}, parts...)
+	}
+	if _, err = oWfAut(os.Stdout, parts...); err != nil {
+		return err
+	}
+
+	for _, ct := range rdap.GetContactCards(aut.Entities) {
+		szEmail := ""
+		if len(ct.Emails) > 0 {
+			szEmail = ct.Emails[0]
+		}
+		parts := []interface{}{
+			strings.Join(ct.Roles, ","),
+			ct.Handle,
+			ct.Name,
+			szEmail,
+		}
+		if cep.PrependQuery {
+			parts = append([]interface{}{cep.Cmd}, parts...)
+		}
+		if _, err = oWfContact(os.Stdout, parts...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (v CmdRDAP_Contacts) Exec(cep CmdExecParams) error {
+
+	_, bsJSON, err := cep.rdapByTarget(cep.Ctx, cep.Db, v.RdapTarget)
+	if err != nil {
+		return err
+	}
+	var obj rdap.Object
+	if err = cep.Rdap.Decode(bsJSON, &obj); err != nil {
+		os.Stderr.Write(bsJSON)
+		return err
+	}
+
+	sCt := rdap.GetContactCards(obj.Entities)
+
+	if v.JSON {
+		if sCt == nil {
+			sCt = []rdap.Contact{}
+		}
+		bsJSON, err := json.Marshal(map[string]interface{}{"contacts": sCt})
+		if err != nil {
+			return err
+		}
+		return cep.PrintJSON(os.Stdout, bsJSON)
+	}
+
+	writerCfg := cw.Cfg{Spacer: "|", Pad: cep.Pretty}
+	ccfg := []cw.ColCfg{
+		cw.ColCfg{Wid: 16, Title: "ROLE"},
+		cw.ColCfg{Wid: 16, Title: "HANDLE"},
+		cw.ColCfg{Wid: 24, Title: "NAME"},
+		cw.ColCfg{Wid: 24, Title: "ORG"},
+		cw.ColCfg{Wid: 24, Title: "EMAIL"},
+		cw.ColCfg{Wid: 24, Title: "TEL"},
+		cw.ColCfg{Title: "ADDRESS"},
+	}
+	if cep.PrependQuery {
+		ccfg = append([]cw.ColCfg{cw.ColCfg{Wid: cep.MaxCmdLen}}, ccfg...)
+	}
+	oWF := writerCfg.NewWriterFuncs(ccfg)
+
+	for _, ct := range sCt {
+
+		var sTel []string
+		for _, ph := range ct.Phones {
+			if len(ph.Types) > 0 {
+				sTel = append(sTel, ph.Number+" ("+strings.Join(ph.Types, ",")+")")
+			} else {
+				sTel = append(sTel, ph.Number)
+			}
+		}
+
+		var sAdr []string
+		for _, adr := range ct.Address {
+			sAdr = append(sAdr, adr.String())
+		}
+
+		parts := []interface{}{
+			strings.Join(ct.Roles, ","),
+			ct.Handle,
+			ct.Name,
+			strings.Join(ct.Org, ", "),
+			strings.Join(ct.Emails, ","),
+			strings.Join(sTel, ", "),
+			strings.Join(sAdr, "; "),
+		}
+		if cep.PrependQuery {
+			parts = append([]interface{}{cep.Cmd}, parts...)
+		}
+		if _, err := oWF(os.Stdout, parts...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (v CmdRDAP_Org) Exec(cep CmdExecParams) error {
 
-	bsJSON, err := rdap.QueryByOrg(v.RIR, v.OrgId)
+	bsJSON, err := cep.rdapGet(cep.Ctx, rdap.EntityUrl(cep.Rdap.BaseUrl(v.RIR), v.OrgId))
 	if err != nil {
 		return err
 	}
@@ -266,7 +532,7 @@ func (v CmdRDAP_Org) Exec(cep CmdExecParams) error {
 	}
 
 	var ent rdap.Entity
-	err = json.Unmarshal(bsJSON, &ent)
+	err = cep.Rdap.Decode(bsJSON, &ent)
 	if err != nil {
 		os.Stderr.Write(bsJSON)
 		return err
@@ -336,21 +602,46 @@ func (v CmdRDAP_Org) Exec(cep CmdExecParams) error {
 	return nil
 }
 
-func (v CmdCC) Exec(cep CmdExecParams) error {
+// walk parsed rows matching fnMatch, returns number of matches
+func walkMatchingRows(
+	db *bbolt.DB, fnMatch func(bsData []byte, pR *Row) bool, fnRow func(*Row) error,
+) (int, error) {
 
-	rw := cep.getRowWriters()
-	bsCC := []byte("|" + strings.ToUpper(v.CC) + "|")
 	nFound := 0
-	err := WalkRawRows(cep.Db, func(_, bsData []byte) error {
-		if !bytes.Contains(bsData, bsCC) {
-			return nil
-		}
-		if row, e2 := ParseRow(bsData); e2 != nil {
+	err := WalkRawRows(db, func(_, bsData []byte) error {
+		row, e2 := ParseRow(bsData)
+		if e2 != nil {
 			return e2
-		} else {
-			nFound += 1
-			return cep.printRow(rw, &row)
 		}
+		if !fnMatch(bsData, &row) {
+			return nil
+		}
+		nFound += 1
+		return fnRow(&row)
+	})
+	return nFound, err
+}
+
+func collectMatchingRows(
+	db *bbolt.DB, fnMatch func(bsData []byte, pR *Row) bool,
+) ([]Row, error) {
+
+	var sRows []Row
+	n, err := walkMatchingRows(db, fnMatch, func(pR *Row) error {
+		sRows = append(sRows, *pR)
+		return nil
+	})
+	if (err == nil) && (n == 0) {
+		err = ENotFound
+	}
+	return sRows, err
+}
+
+func (cep CmdExecParams) printMatchingRows(fnMatch func(bsData []byte, pR *Row) bool) error {
+
+	rw := cep.getRowWriters()
+	nFound, err := walkMatchingRows(cep.Db, fnMatch, func(pR *Row) error {
+		return cep.printRow(rw, pR)
 	})
 	if err != nil {
 		return err
@@ -361,15 +652,49 @@ func (v CmdCC) Exec(cep CmdExecParams) error {
 	return nil
 }
 
+func (v CmdCC) match(bsData []byte, pR *Row) bool {
+	return bytes.Equal(pR.Cc, []byte(strings.ToUpper(v.CC)))
+}
+
+func (v CmdCC) Rows(db *bbolt.DB, _ StatusSet) ([]Row, error) {
+	return collectMatchingRows(db, v.match)
+}
+
+func (v CmdCC) Exec(cep CmdExecParams) error {
+
+	bsCC := []byte("|" + strings.ToUpper(v.CC) + "|")
+	return cep.printMatchingRows(func(bsData []byte, pR *Row) bool {
+		return bytes.Contains(bsData, bsCC) &&
+			v.match(bsData, pR) &&
+			cep.Statuses.Has(pR.Status)
+	})
+}
+
+func (v CmdStatus) match(bsData []byte, pR *Row) bool {
+	if (len(v.CC) > 0) && !bytes.Equal(pR.Cc, []byte(v.CC)) {
+		return false
+	}
+	return v.Statuses.Has(pR.Status)
+}
+
+func (v CmdStatus) Rows(db *bbolt.DB, _ StatusSet) ([]Row, error) {
+	return collectMatchingRows(db, v.match)
+}
+
+// NOTE: explicit statuses, not limited by -include-status
+func (v CmdStatus) Exec(cep CmdExecParams) error {
+	return cep.printMatchingRows(v.match)
+}
+
 func (v CmdEmail) Exec(cep CmdExecParams) error {
 
-	bsJSON, err := rdapByIp(cep.Db, v.IP)
+	bsJSON, err := cep.rdapByIp(cep.Ctx, cep.Db, v.IP)
 	if err != nil {
 		return err
 	}
 
 	var oNet rdap.IPNetwork
-	err = json.Unmarshal(bsJSON, &oNet)
+	err = cep.Rdap.Decode(bsJSON, &oNet)
 	if err != nil {
 		os.Stderr.Write(bsJSON)
 		return err
@@ -407,6 +732,8 @@ func (v CmdAll) Exec(cep CmdExecParams) error {
 	return WalkRawRows(cep.Db, func(_, bsData []byte) error {
 		if row, e2 := ParseRow(bsData); e2 != nil {
 			return e2
+		} else if !cep.Statuses.Has(row.Status) {
+			return nil
 		} else {
 			return cep.printRow(rw, &row)
 		}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	cw "github.com/BourgeoisBear/nicsearch/colwriter"
+)
+
+type CmdDiff struct {
+	From, To string
+}
+
+type DiffKind int
+
+const (
+	DkNew DiffKind = iota
+	DkReturned
+	DkCc
+	DkStatus
+	DkRegId
+	DkSize
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DkNew:
+		return "NEW"
+	case DkReturned:
+		return "RETURNED"
+	case DkCc:
+		return "CC"
+	case DkStatus:
+		return "STATUS"
+	case DkRegId:
+		return "REGID"
+	case DkSize:
+		return "SIZE"
+	}
+	return "UNKNOWN"
+}
+
+type DiffItem struct {
+	Kind     DiffKind
+	Row      Row
+	Old, New string
+}
+
+type DelegationSet struct {
+	Rows       map[string]Row  // keyed by registry, type & start of resource
+	Registries map[string]bool // registries with rows of any status
+}
+
+// rows of every status from a set of gzipped delegation files
+func ReadDelegationSet(sFnames []string) (DelegationSet, error) {
+
+	ret := DelegationSet{
+		Rows:       make(map[string]Row),
+		Registries: make(map[string]bool),
+	}
+	for _, fname := range sFnames {
+		err := ReadDelegations(fname, func(row Row) error {
+			ret.Registries[string(row.Registry)] = true
+			key := strings.Join([]string{
+				string(row.Registry),
+				string(row.Type),
+				string(row.Start),
+			}, "|")
+			ret.Rows[key] = row
+			return nil
+		})
+		if err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
+
+// registries of one set absent from the other, sorted
+func (ds DelegationSet) MissingFrom(other DelegationSet) []string {
+
+	var ret []string
+	for reg := range ds.Registries {
+		if !other.Registries[reg] {
+			ret = append(ret, reg)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// walk indexable rows of a gzipped delegation file
+func ReadDelegations(fname string, fnRow func(Row) error) error {
+
+	pF, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer pF.Close()
+
+	gzr, err := gzip.NewReader(pF)
+	if err != nil {
+		return err
+	}
+	defer gzr.Close()
+
+	bSkipFirstDataRow := true
+	pSc := bufio.NewScanner(gzr)
+	for pSc.Scan() {
+
+		bsLine := bytes.TrimSpace(pSc.Bytes())
+		if (len(bsLine) == 0) || bytes.HasPrefix(bsLine, []byte("#")) {
+			continue
+		}
+
+		// skip version header & summaries
+		if bSkipFirstDataRow {
+			bSkipFirstDataRow = false
+			continue
+		}
+		if bytes.HasSuffix(bsLine, []byte("|summary")) {
+			continue
+		}
+
+		bsLine = bytes.ToUpper(bsLine)
+		if !keepDelegation(bsLine) {
+			continue
+		}
+
+		row, err := ParseRow(bsLine)
+		if err != nil {
+			continue
+		}
+		if err = fnRow(row); err != nil {
+			return err
+		}
+	}
+
+	return pSc.Err()
+}
+
+/*
+changes between two delegation sets, for registries present in both.
+a registry absent from either side (i.e. from a partial snapshot) is
+skipped, rather than reported as wholly new or returned.  both sets hold
+rows of every status, so that e.g. an allocation turning reserved is a
+status change; only resources of a status in ss, on either side, are
+reported.
+*/
+func DiffDelegationSets(dsOld, dsNew DelegationSet, ss StatusSet) []DiffItem {
+
+	var ret []DiffItem
+
+	for key, rNew := range dsNew.Rows {
+
+		if !dsOld.Registries[string(rNew.Registry)] {
+			continue
+		}
+
+		rOld, ok := dsOld.Rows[key]
+		if !ok {
+			if ss.Has(rNew.Status) {
+				ret = append(ret, DiffItem{Kind: DkNew, Row: rNew, New: string(rNew.RegId)})
+			}
+			continue
+		}
+		if !ss.Has(rOld.Status) && !ss.Has(rNew.Status) {
+			continue
+		}
+
+		if !bytes.Equal(rOld.Cc, rNew.Cc) {
+			ret = append(ret, DiffItem{
+				Kind: DkCc, Row: rNew,
+				Old: string(rOld.Cc), New: string(rNew.Cc),
+			})
+		}
+		if !bytes.Equal(rOld.Status, rNew.Status) {
+			ret = append(ret, DiffItem{
+				Kind: DkStatus, Row: rNew,
+				Old: string(rOld.Status), New: string(rNew.Status),
+			})
+		}
+		if !bytes.Equal(rOld.RegId, rNew.RegId) {
+			ret = append(ret, DiffItem{
+				Kind: DkRegId, Row: rNew,
+				Old: string(rOld.RegId), New: string(rNew.RegId),
+			})
+		}
+		if rOld.ValueInt != rNew.ValueInt {
+			ret = append(ret, DiffItem{
+				Kind: DkSize, Row: rNew,
+				Old: string(rOld.Value), New: string(rNew.Value),
+			})
+		}
+	}
+
+	for key, rOld := range dsOld.Rows {
+		if !dsNew.Registries[string(rOld.Registry)] {
+			continue
+		}
+		if _, ok := dsNew.Rows[key]; !ok && ss.Has(rOld.Status) {
+			ret = append(ret, DiffItem{Kind: DkReturned, Row: rOld, Old: string(rOld.RegId)})
+		}
+	}
+
+	// order by registry, change, type, then resource
+	sort.Slice(ret, func(i, j int) bool {
+		ri, rj := &ret[i].Row, &ret[j].Row
+		if c := bytes.Compare(ri.Registry, rj.Registry); c != 0 {
+			return c < 0
+		}
+		if ret[i].Kind != ret[j].Kind {
+			return ret[i].Kind < ret[j].Kind
+		}
+		if ri.TypeInt != rj.TypeInt {
+			return ri.TypeInt < rj.TypeInt
+		}
+		if ri.IsType(TkASN) {
+			return ri.ASN < rj.ASN
+		}
+		return ri.IpStart.Less(rj.IpStart)
+	})
+
+	return ret
+}
+
+// delegation files for 'CURRENT', or for the snapshot nearest to a date
+func (m *Modes) diffSetFiles(which string) ([]string, string, error) {
+
+	if (len(which) == 0) || (which == "CURRENT") {
+		sFiles, err := filepath.Glob(
+			filepath.Join(m.DbPath, "delegated-*-extended-latest.txt.gz"),
+		)
+		return sFiles, "current", err
+	}
+
+	asOf, err := time.Parse("2006-01-02", which)
+	if err != nil {
+		return nil, "", fmt.Errorf("'%s' is neither CURRENT nor a YYYY-MM-DD date", which)
+	}
+
+	day, err := m.nearestSnapshot(asOf)
+	if err != nil {
+		return nil, "", err
+	}
+	sFiles, err := SnapshotFiles(m.DbPath, day)
+	return sFiles, day.Format("2006-01-02"), err
+}
+
+func (v CmdDiff) Exec(cep CmdExecParams) error {
+
+	sFrom, szFrom, err := cep.diffSetFiles(v.From)
+	if err != nil {
+		return err
+	}
+	sTo, szTo, err := cep.diffSetFiles(v.To)
+	if err != nil {
+		return err
+	}
+	cep.AnsiMsg(os.Stderr, "DIFF", szFrom+" -> "+szTo, []uint8{1, 96})
+
+	dsOld, err := ReadDelegationSet(sFrom)
+	if err != nil {
+		return err
+	}
+	dsNew, err := ReadDelegationSet(sTo)
+	if err != nil {
+		return err
+	}
+
+	// registries only on one side are not compared
+	for _, reg := range dsNew.MissingFrom(dsOld) {
+		cep.AnsiMsg(os.Stderr, "WARNING", reg+" absent from "+szFrom+", not compared", []uint8{1, 93})
+	}
+	for _, reg := range dsOld.MissingFrom(dsNew) {
+		cep.AnsiMsg(os.Stderr, "WARNING", reg+" absent from "+szTo+", not compared", []uint8{1, 93})
+	}
+
+	writerCfg := cw.Cfg{Spacer: "|", Pad: cep.Pretty}
+	ccfg := []cw.ColCfg{
+		cw.ColCfg{Wid: 9, Title: "RIR"},
+		cw.ColCfg{Wid: 8, Title: "CHG"},
+		cw.ColCfg{Wid: 3, Title: "CC"},
+		cw.ColCfg{Wid: 4, Title: "TYPE"},
+		cw.ColCfg{Wid: 23, Title: "RESOURCE", Rt: true},
+		cw.ColCfg{Wid: 10, Title: "OLD"},
+		cw.ColCfg{Title: "NEW"},
+	}
+	if cep.PrependQuery {
+		ccfg = append([]cw.ColCfg{cw.ColCfg{Wid: cep.MaxCmdLen}}, ccfg...)
+	}
+	oWF := writerCfg.NewWriterFuncs(ccfg)
+
+	for _, di := range DiffDelegationSets(dsOld, dsNew, cep.Statuses) {
+
+		var sRsrc []string
+		if di.Row.IsType(TkASN) {
+			sz := FormatASN(di.Row.ASN, cep.AsDot)
+			if di.Row.ValueInt > 1 {
+				sz += "-" + FormatASN(di.Row.ASN+uint32(di.Row.ValueInt-1), cep.AsDot)
+			}
+			sRsrc = []string{sz}
+		} else {
+			for _, pfx := range di.Row.IpRange {
+				sRsrc = append(sRsrc, pfx.String())
+			}
+		}
+
+		for _, rsrc := range sRsrc {
+			parts := []interface{}{
+				di.Row.Registry,
+				di.Kind.String(),
+				di.Row.Cc,
+				di.Row.Type,
+				rsrc,
+				di.Old,
+				di.New,
+			}
+			if cep.PrependQuery {
+				parts = append([]interface{}{cep.Cmd}, parts...)
+			}
+			if _, err := oWF(os.Stdout, parts...); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDiffDelegationSets(t *testing.T) {
+
+	dir := t.TempDir()
+	fnSet := func(name string, mRegRows map[string][]string) DelegationSet {
+		var sFnames []string
+		for reg, sRows := range mRegRows {
+			fname := filepath.Join(dir, name+"-"+reg+".txt.gz")
+			writeGzLines(t, fname, append([]string{"2|" + reg + "|20240101|1|19700101|20240101|+0000"}, sRows...))
+			sFnames = append(sFnames, fname)
+		}
+		ds, err := ReadDelegationSet(sFnames)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ds
+	}
+
+	dsOld := fnSet("old", map[string][]string{
+		"arin": {
+			"arin|US|ipv4|192.0.2.0|256|20000101|allocated|ORG-A",
+			"arin|US|ipv4|198.51.100.0|256|20000101|allocated|ORG-B",
+			"arin|US|asn|64496|1|20000101|assigned|ORG-A",
+			"arin|US|ipv4|203.0.113.0|256|20000101|allocated|ORG-D",
+			"arin|US|ipv4|198.18.0.0|256|20000101|reserved|",
+			"arin|US|ipv4|100.64.0.0|256|20000101|available|",
+		},
+		"lacnic": {
+			"lacnic|BR|ipv4|200.0.0.0|256|20000101|allocated|ORG-L",
+		},
+	})
+	dsNew := fnSet("new", map[string][]string{
+		"arin": {
+			"arin|US|ipv4|192.0.2.0|512|20000101|allocated|ORG-A",
+			"arin|CA|asn|64496|1|20000101|assigned|ORG-A",
+			"arin|US|asn|64500|1|20000101|assigned|ORG-C",
+			"arin|US|ipv4|203.0.113.0|256|20000101|reserved|",
+			"arin|US|ipv4|198.18.0.0|256|20000101|assigned|ORG-E",
+			"arin|US|ipv4|100.65.0.0|256|20000101|available|",
+		},
+		"ripencc": {
+			"ripencc|NL|ipv4|193.0.0.0|256|20000101|allocated|ORG-R",
+		},
+	})
+
+	if got := dsNew.MissingFrom(dsOld); !reflect.DeepEqual(got, []string{"RIPENCC"}) {
+		t.Errorf("new registries: got %q", got)
+	}
+	if got := dsOld.MissingFrom(dsNew); !reflect.DeepEqual(got, []string{"LACNIC"}) {
+		t.Errorf("dropped registries: got %q", got)
+	}
+
+	/*
+		resized ranges & status changes are modifications, not returned &
+		new; one-sided registries skipped; resources of other statuses on
+		both sides left out
+	*/
+	want := []string{
+		"ARIN NEW ASN 64500 - ORG-C",
+		"ARIN RETURNED IPV4 198.51.100.0 ORG-B -",
+		"ARIN CC ASN 64496 US CA",
+		"ARIN SIZE IPV4 192.0.2.0 256 512",
+		"ARIN STATUS IPV4 203.0.113.0 ALLOCATED RESERVED",
+		"ARIN REGID IPV4 203.0.113.0 ORG-D ",
+		"ARIN STATUS IPV4 198.18.0.0 RESERVED ASSIGNED",
+		"ARIN REGID IPV4 198.18.0.0  ORG-E",
+	}
+	wantAll := append([]string{
+		"ARIN NEW IPV4 100.65.0.0 - ",
+		"ARIN RETURNED IPV4 100.64.0.0  -",
+	}, want...)
+
+	for _, tc := range []struct {
+		ss   StatusSet
+		want []string
+	}{{DefaultStatusSet(), want}, {AllStatusSet(), wantAll}} {
+
+		var got []string
+		for _, di := range DiffDelegationSets(dsOld, dsNew, tc.ss) {
+			sOld, sNew := di.Old, di.New
+			if di.Kind == DkNew {
+				sOld = "-"
+			}
+			if di.Kind == DkReturned {
+				sNew = "-"
+			}
+			got = append(got, strings.Join([]string{
+				string(di.Row.Registry), di.Kind.String(), string(di.Row.Type),
+				string(di.Row.Start), sOld, sNew,
+			}, " "))
+		}
+
+		sort.Strings(got)
+		sort.Strings(tc.want)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: got %q\nwant %q", tc.ss, got, tc.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"compress/bzip2"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/BourgeoisBear/nicsearch/rdap"
@@ -41,10 +43,72 @@ func GetRIRDownloadItems(dbPath string) map[rdap.RIRKey]DownloadItem {
 	}
 }
 
+// archived extended delegations from an RIR for a specific day.
+// RIRs differ in archive layout & compression, so multiple candidate
+// paths are returned, to be tried in order.
+func archiveRIRItems(dbPath, host, key string, day time.Time) []DownloadItem {
+
+	szYear := day.Format("2006")
+	szDay := day.Format("20060102")
+	fname := fmt.Sprintf("delegated-%s-extended-%s", key, szDay)
+
+	var sDirs []string
+	switch key {
+	case "arin", "lacnic":
+		sDirs = []string{
+			fmt.Sprintf("pub/stats/%s/archive/%s", key, szYear),
+			fmt.Sprintf("pub/stats/%s", key),
+		}
+	default:
+		sDirs = []string{
+			fmt.Sprintf("pub/stats/%s/%s", key, szYear),
+			fmt.Sprintf("pub/stats/%s", key),
+		}
+	}
+
+	dst := filepath.Join(
+		SnapshotDayDir(dbPath, day),
+		fmt.Sprintf("delegated-%s-extended-latest.txt.gz", key),
+	)
+
+	ret := make([]DownloadItem, 0, len(sDirs)*3)
+	for _, dir := range sDirs {
+		for _, ext := range []string{"", ".gz", ".bz2"} {
+			ret = append(ret, DownloadItem{
+				Host:    host,
+				SrcPath: dir + "/" + fname + ext,
+				DstPath: dst,
+			})
+		}
+	}
+	return ret
+}
+
+func GetRIRArchiveItems(dbPath string, day time.Time) map[rdap.RIRKey][]DownloadItem {
+	return map[rdap.RIRKey][]DownloadItem{
+		rdap.RkRipe:    archiveRIRItems(dbPath, "ftp.ripe.net", "ripencc", day),
+		rdap.RkLacnic:  archiveRIRItems(dbPath, "ftp.lacnic.net", "lacnic", day),
+		rdap.RkAfrinic: archiveRIRItems(dbPath, "ftp.afrinic.net", "afrinic", day),
+		rdap.RkApnic:   archiveRIRItems(dbPath, "ftp.apnic.net", "apnic", day),
+		rdap.RkArin:    archiveRIRItems(dbPath, "ftp.arin.net", "arin", day),
+	}
+}
+
+type countingReader struct {
+	io.Reader
+	N int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.Reader.Read(p)
+	cr.N += int64(n)
+	return n, err
+}
+
 // download extended delegations list from an RIR
 func (m *Modes) DownloadAll(
 	out io.Writer, oR DownloadItem, dirTmp string,
-) error {
+) (err error) {
 
 	const DEBUG = false
 
@@ -54,7 +118,7 @@ func (m *Modes) DownloadAll(
 		url = "http://localhost:9090/delegated-afrinic-extended-latest.txt"
 	}
 
-	_, err := m.AnsiMsg(os.Stderr, "DOWNLOADING", url, []uint8{1, 96})
+	_, err = m.AnsiMsg(os.Stderr, "DOWNLOADING", url, []uint8{1, 96})
 	if err != nil {
 		return err
 	}
@@ -81,6 +145,21 @@ func (m *Modes) DownloadAll(
 		}
 	}
 
+	// decompress archived sources before re-compressing as gzip
+	pCount := &countingReader{Reader: rsp.Body}
+	var iSrc io.Reader = pCount
+	switch {
+	case strings.HasSuffix(oR.SrcPath, ".bz2"):
+		iSrc = bzip2.NewReader(pCount)
+	case strings.HasSuffix(oR.SrcPath, ".gz"):
+		gzR, err := gzip.NewReader(pCount)
+		if err != nil {
+			return errors.WithMessage(err, "gunzip")
+		}
+		defer gzR.Close()
+		iSrc = gzR
+	}
+
 	// create tempfile for download
 	dstFname := filepath.Base(oR.DstPath)
 	pF, err := os.CreateTemp(dirTmp, "*-"+dstFname)
@@ -91,11 +170,15 @@ func (m *Modes) DownloadAll(
 	// gzip contents
 	gzF := gzip.NewWriter(pF)
 
-	// cleanup
+	// cleanup: keep only complete files, flushed without error
 	defer func() {
 		tmpname := pF.Name()
-		gzF.Close()
-		pF.Close()
+		if eClose := gzF.Close(); err == nil {
+			err = eClose
+		}
+		if eClose := pF.Close(); err == nil {
+			err = eClose
+		}
 		if err != nil {
 			// delete tempfile
 			os.Remove(tmpname)
@@ -108,11 +191,11 @@ func (m *Modes) DownloadAll(
 	// save downloaded file, report progress
 	var nCopied int64
 	for {
-		ntmp, err := io.CopyN(gzF, rsp.Body, 1024*64)
+		_, err = io.CopyN(gzF, iSrc, 1024*64)
 		if err != nil && err != io.EOF {
 			return err
 		}
-		nCopied += ntmp
+		nCopied = pCount.N
 
 		if nBytesTot > 0 {
 			pct := (float64(nCopied) / float64(nBytesTot)) * 100.0
@@ -131,6 +214,7 @@ func (m *Modes) DownloadAll(
 
 		if err == io.EOF {
 			fmt.Fprintln(out, "")
+			err = nil
 			break
 		}
 	}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadAllCleanup(t *testing.T) {
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.Write([]byte("2|test|20240101|0|19700101|20240101|+0000\n"))
+		case "/corrupt.gz":
+			w.Write([]byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xffnot deflate"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	oldClient := http.DefaultClient
+	http.DefaultClient = srv.Client()
+	defer func() { http.DefaultClient = oldClient }()
+
+	m := &Modes{}
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	tests := []struct {
+		src   string
+		bFail bool
+	}{
+		{"ok", false},
+		{"corrupt.gz", true},
+		{"missing", true},
+	}
+
+	for _, tc := range tests {
+
+		dir := t.TempDir()
+		dst := filepath.Join(dir, "out.txt.gz")
+		err := m.DownloadAll(os.Stderr, DownloadItem{Host: host, SrcPath: tc.src, DstPath: dst}, dir)
+		if (err != nil) != tc.bFail {
+			t.Errorf("%s: error %v, want failure %v", tc.src, err, tc.bFail)
+		}
+
+		// only the complete download is left behind
+		sEnt, _ := os.ReadDir(dir)
+		if tc.bFail && (len(sEnt) > 0) {
+			t.Errorf("%s: left %d files", tc.src, len(sEnt))
+		}
+		if !tc.bFail && ((len(sEnt) != 1) || !Exists(dst)) {
+			t.Errorf("%s: got %d files, want only %s", tc.src, len(sEnt), dst)
+		}
+	}
+}
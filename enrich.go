@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// columns/keys appended to each record
+var g_enrichCols = []string{
+	"nic_registry", "nic_cc", "nic_subnet", "nic_asn", "nic_asname", "nic_regid",
+}
+
+type Enricher struct {
+	*Modes
+	Tx    *bbolt.Tx
+	Field string // CSV column name, or dotted JSON key path
+
+	mVals map[netip.Addr][]string
+}
+
+// g_enrichCols values of an IP field, all empty when unknown
+func (pE *Enricher) Values(szIP string) ([]string, error) {
+
+	ret := make([]string, len(g_enrichCols))
+
+	ip, err := ParseAddrLoose(szIP)
+	if err != nil {
+		return ret, nil
+	}
+	ip = ip.Unmap()
+
+	if sVals, ok := pE.mVals[ip]; ok {
+		return sVals, nil
+	}
+
+	org, err := IpToOrgTx(pE.Tx, ip, pE.Statuses)
+
+	switch err {
+	case nil:
+		ret[0] = strings.ToLower(string(org.Row.Registry))
+		ret[1] = string(org.Row.Cc)
+		for _, pfx := range org.Row.IpRange {
+			if pfx.Contains(ip) {
+				ret[2] = pfx.String()
+				break
+			}
+		}
+		if org.HasASN {
+			ret[3] = FormatASN(org.ASN, pE.AsDot)
+			ret[4] = string(org.AsName)
+		}
+		ret[5] = string(org.Row.RegId)
+	case ENotFound:
+	default:
+		return nil, err
+	}
+
+	if pE.mVals == nil || len(pE.mVals) >= AnnotateCacheMax {
+		pE.mVals = make(map[netip.Addr][]string)
+	}
+	pE.mVals[ip] = ret
+	return ret, nil
+}
+
+// CSV with a header row, appending g_enrichCols to every record
+func (pE *Enricher) RunCSV(iRd io.Reader, iWri io.Writer) error {
+
+	rd := csv.NewReader(iRd)
+	rd.FieldsPerRecord = -1
+	rd.ReuseRecord = true
+
+	wr := csv.NewWriter(iWri)
+	defer wr.Flush()
+
+	sHdr, err := rd.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+
+	ixField := -1
+	for ix := range sHdr {
+		if sHdr[ix] == pE.Field {
+			ixField = ix
+			break
+		}
+		if (ixField < 0) && strings.EqualFold(strings.TrimSpace(sHdr[ix]), pE.Field) {
+			ixField = ix
+		}
+	}
+	if ixField < 0 {
+		return fmt.Errorf("column '%s' not found in CSV header", pE.Field)
+	}
+
+	sHdr = append([]string(nil), sHdr...)
+	if err = wr.Write(append(sHdr, g_enrichCols...)); err != nil {
+		return err
+	}
+
+	for {
+		sRec, err := rd.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// added columns must align with header: pad short records,
+		// refuse long ones rather than drop their extra fields
+		if len(sRec) > len(sHdr) {
+			line, _ := rd.FieldPos(len(sHdr))
+			return fmt.Errorf(
+				"CSV line %d: %d fields, header has %d", line, len(sRec), len(sHdr),
+			)
+		}
+		for len(sRec) < len(sHdr) {
+			sRec = append(sRec, "")
+		}
+
+		szIP := sRec[ixField]
+		sVals, err := pE.Values(szIP)
+		if err != nil {
+			return err
+		}
+		if err = wr.Write(append(sRec, sVals...)); err != nil {
+			return err
+		}
+	}
+}
+
+// value at dotted key path of a decoded JSON object, as a string
+func jsonPathString(iVal interface{}, sPath []string) (string, bool) {
+
+	for _, key := range sPath {
+		mObj, ok := iVal.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if iVal, ok = mObj[key]; !ok {
+			return "", false
+		}
+	}
+
+	sz, ok := iVal.(string)
+	return sz, ok
+}
+
+/*
+NDJSON, appending g_enrichCols keys to every object.  Keys are spliced
+into the raw line, so key order & formatting of the input are kept.
+Lines that are not JSON objects pass through unchanged.
+*/
+func (pE *Enricher) RunNDJSON(iRd io.Reader, iWri io.Writer) error {
+
+	sPath := strings.Split(pE.Field, ".")
+
+	sc := bufio.NewScanner(iRd)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	bw := bufio.NewWriter(iWri)
+	defer bw.Flush()
+
+	for sc.Scan() {
+
+		bsLine := bytes.TrimRight(sc.Bytes(), " \t\r")
+		var iObj interface{}
+		ixClose := bytes.LastIndexByte(bsLine, '}')
+		if (ixClose < 0) || (json.Unmarshal(bsLine, &iObj) != nil) {
+			bw.Write(bsLine)
+			bw.WriteByte('\n')
+			continue
+		}
+		if _, ok := iObj.(map[string]interface{}); !ok {
+			bw.Write(bsLine)
+			bw.WriteByte('\n')
+			continue
+		}
+
+		szIP, _ := jsonPathString(iObj, sPath)
+		sVals, err := pE.Values(szIP)
+		if err != nil {
+			return err
+		}
+
+		// splice before closing brace, with a comma unless empty '{}'
+		bw.Write(bsLine[:ixClose])
+		bSep := len(bytes.TrimSpace(bsLine[bytes.IndexByte(bsLine, '{')+1:ixClose])) > 0
+		for ix, col := range g_enrichCols {
+			if bSep {
+				bw.WriteByte(',')
+			}
+			bsKey, _ := json.Marshal(col)
+			bsVal, _ := json.Marshal(sVals[ix])
+			bw.Write(bsKey)
+			bw.WriteByte(':')
+			bw.Write(bsVal)
+			bSep = true
+		}
+		bw.Write(bsLine[ixClose:])
+		if err = bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
+
+// 'enrich' sub-command: parses its own flags from sArgs
+func (m *Modes) Enrich(db *bbolt.DB, sArgs []string) error {
+
+	fs := flag.NewFlagSet("enrich", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	szIn := fs.String("in", "-", "input `FILE` ('-' for stdin)")
+	szField := fs.String("field", "", "CSV column name, or dotted JSON key `PATH`, holding IP addresses")
+	szFormat := fs.String("format", "", "input format, 'csv' or 'ndjson' (default: by file extension, else csv)")
+	if err := fs.Parse(sArgs); err != nil {
+		return err
+	}
+
+	if len(*szField) == 0 {
+		return fmt.Errorf("enrich: -field is required")
+	}
+
+	format := strings.ToLower(*szFormat)
+	if len(format) == 0 {
+		switch strings.ToLower(filepath.Ext(*szIn)) {
+		case ".json", ".jsonl", ".ndjson":
+			format = "ndjson"
+		default:
+			format = "csv"
+		}
+	}
+
+	var iRd io.Reader = os.Stdin
+	if *szIn != "-" {
+		pF, err := os.Open(*szIn)
+		if err != nil {
+			return err
+		}
+		defer pF.Close()
+		iRd = pF
+	}
+
+	return db.View(func(tx *bbolt.Tx) error {
+
+		pE := &Enricher{Modes: m, Tx: tx, Field: *szField}
+		switch format {
+		case "csv":
+			return pE.RunCSV(iRd, os.Stdout)
+		case "ndjson":
+			return pE.RunNDJSON(iRd, os.Stdout)
+		}
+		return fmt.Errorf("enrich: invalid -format '%s' (expected 'csv' or 'ndjson')", *szFormat)
+	})
+}
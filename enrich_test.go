@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestEnrichRunCSV(t *testing.T) {
+
+	db := newTestIndex(t, []string{
+		"arin|US|ipv4|192.0.2.0|256|20000101|allocated|ORG-A",
+	})
+	m := &Modes{Statuses: DefaultStatusSet()}
+
+	tests := []struct {
+		name, in string
+		errLine  string // in error, when rejected
+	}{
+		{"aligned", "ip,note\n192.0.2.1,x\n", ""},
+		{"short", "ip,note\n192.0.2.1,x\n192.0.2.2\n", ""},
+		{"long", "ip,note\n192.0.2.1,x\n192.0.2.2,y,extra\n", "line 3"},
+		{"long, quoted newline", "ip,note\n192.0.2.1,\"x\ny\"\n192.0.2.2,y,extra\n", "line 4"},
+	}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		for _, tc := range tests {
+
+			var out bytes.Buffer
+			pE := &Enricher{Modes: m, Tx: tx, Field: "ip"}
+			err := pE.RunCSV(strings.NewReader(tc.in), &out)
+
+			if len(tc.errLine) > 0 {
+				if (err == nil) || !strings.Contains(err.Error(), tc.errLine) {
+					t.Errorf("%s: got %v, want error at %s", tc.name, err, tc.errLine)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %v", tc.name, err)
+				continue
+			}
+
+			// added columns line up with the header
+			sRecs, err := csv.NewReader(&out).ReadAll()
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			nCols := len(sRecs[0])
+			ixRegId := nCols - 1
+			if sRecs[0][ixRegId] != "nic_regid" {
+				t.Fatalf("%s: header %q", tc.name, sRecs[0])
+			}
+			for _, sRec := range sRecs[1:] {
+				if (len(sRec) != nCols) || (sRec[ixRegId] != "ORG-A") {
+					t.Errorf("%s: misaligned record %q", tc.name, sRec)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
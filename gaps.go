@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+
+	cw "github.com/BourgeoisBear/nicsearch/colwriter"
+	"go.etcd.io/bbolt"
+)
+
+type CmdGaps struct {
+	Prefix netip.Prefix // invalid for whole IPv4 & IPv6 spaces
+}
+
+var (
+	g_pfxAllV4 = netip.MustParsePrefix("0.0.0.0/0")
+	g_pfxAllV6 = netip.MustParsePrefix("::/0")
+)
+
+// walk rows of the v4/v6 index, of the statuses in ss, whose ranges
+// overlap with 'within'
+func OverlappingRowsTx(
+	tx *bbolt.Tx, within IpSpan, ss StatusSet, fnRow func(Row, IpSpan) error,
+) error {
+
+	ipix := BiV4
+	if within.First.Is6() {
+		ipix = BiV6
+	}
+	bktIp, err := GetBucket(tx, ipix.Key())
+	if err != nil {
+		return err
+	}
+	bktRows, err := GetBucket(tx, BiRow.Key())
+	if err != nil {
+		return err
+	}
+
+	bsFirst := within.First.AsSlice()
+	bsLast := within.Last.AsSlice()
+
+	// each of the rows starting at one key
+	fnVisit := func(v []byte, fnSpan func(Row, IpSpan) error) error {
+
+		for ; len(v) >= RowIxLen; v = v[RowIxLen:] {
+
+			bsRow := bktRows.Get(v[:RowIxLen])
+			if !ss.HasLine(bsRow) {
+				continue
+			}
+
+			row, err := ParseRow(bsRow)
+			if err != nil {
+				return err
+			}
+
+			span, ok := RowSpan(&row)
+			if !ok || span.Last.Less(within.First) || within.Last.Less(span.First) {
+				continue
+			}
+			if err = fnSpan(row, span); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	/*
+		rows starting before 'within' may reach into it, past smaller rows
+		between them.  walk back to where even the largest row could not.
+	*/
+	bsFloor := reachFloor(within.First, MaxHostBitsTx(tx, within.First.Is6(), ss)).AsSlice()
+
+	var sBefore []Row
+	var sBeforeSpan []IpSpan
+	cur := bktIp.Cursor()
+	k, v := cur.Seek(bsFirst)
+	if k == nil {
+		k, v = cur.Last()
+	} else {
+		k, v = cur.Prev()
+	}
+	for ; (k != nil) && (bytes.Compare(k, bsFloor) >= 0); k, v = cur.Prev() {
+		err = fnVisit(v, func(row Row, span IpSpan) error {
+			sBefore = append(sBefore, row)
+			sBeforeSpan = append(sBeforeSpan, span)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// in key order
+	for ix := len(sBefore) - 1; ix >= 0; ix-- {
+		if err = fnRow(sBefore[ix], sBeforeSpan[ix]); err != nil {
+			return err
+		}
+	}
+
+	for k, v = cur.Seek(bsFirst); (k != nil) && (bytes.Compare(k, bsLast) <= 0); k, v = cur.Next() {
+		if err = fnVisit(v, fnRow); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+lowest start of a row of up to 2^nHostBits addresses that can reach ip:
+the start of the aligned block of that size before the one holding ip.
+*/
+func reachFloor(ip netip.Addr, nHostBits int) netip.Addr {
+
+	pfx, _ := ip.Prefix(ip.BitLen() - nHostBits)
+	if prev := pfx.Addr().Prev(); prev.IsValid() {
+		pfx, _ = prev.Prefix(pfx.Bits())
+	}
+	return pfx.Addr()
+}
+
+// allocated/assigned spans overlapping with 'within', from the v4/v6 index
+func DelegatedSpansTx(tx *bbolt.Tx, within IpSpan) ([]IpSpan, error) {
+
+	var ret []IpSpan
+	err := OverlappingRowsTx(tx, within, DefaultStatusSet(), func(_ Row, span IpSpan) error {
+		ret = append(ret, span)
+		return nil
+	})
+	return ret, err
+}
+
+// spans inside of 'within' lacking any allocated/assigned delegation
+func GapsTx(tx *bbolt.Tx, within IpSpan) ([]IpSpan, error) {
+
+	sCovered, err := DelegatedSpansTx(tx, within)
+	if err != nil {
+		return nil, err
+	}
+	return SubtractSpans(within, MergeSpans(sCovered)), nil
+}
+
+type CmdNet struct {
+	Prefix netip.Prefix
+	Assoc  bool
+}
+
+func (v CmdNet) Rows(db *bbolt.DB, ss StatusSet) ([]Row, error) {
+
+	var sRows []Row
+	err := db.View(func(tx *bbolt.Tx) error {
+		return OverlappingRowsTx(
+			tx, PrefixSpan(v.Prefix), ss,
+			func(row Row, _ IpSpan) error {
+				sRows = append(sRows, row)
+				return nil
+			},
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sRows) == 0 {
+		return nil, ENotFound
+	}
+
+	if !v.Assoc {
+		return sRows, nil
+	}
+
+	// collect associateds of each unique reg-id
+	byRegId, sKeys := UniqueRegIds(sRows)
+	sRows = nil
+	for _, k := range sKeys {
+		pr := byRegId[k]
+		sTmp, err := FindAssociated(db, pr.Registry, pr.RegId)
+		if err != nil {
+			return nil, err
+		}
+		sRows = append(sRows, sTmp...)
+	}
+	return sRows, nil
+}
+
+func (v CmdNet) Exec(cep CmdExecParams) error {
+
+	sRows, err := cep.listRows(cep.Db, v)
+	if err != nil {
+		return err
+	}
+	return cep.printRowsSorted(cep.getRowWriters(), sRows)
+}
+
+func (v CmdGaps) prefixes() []netip.Prefix {
+	if v.Prefix.IsValid() {
+		return []netip.Prefix{v.Prefix.Masked()}
+	}
+	return []netip.Prefix{g_pfxAllV4, g_pfxAllV6}
+}
+
+func (v CmdGaps) Exec(cep CmdExecParams) error {
+
+	writerCfg := cw.Cfg{Spacer: "|", Pad: cep.Pretty}
+	ccfg := []cw.ColCfg{
+		cw.ColCfg{Wid: 4, Title: "TYPE"},
+		cw.ColCfg{Title: "GAP"},
+	}
+	if cep.PrependQuery {
+		ccfg = append([]cw.ColCfg{cw.ColCfg{Wid: cep.MaxCmdLen}}, ccfg...)
+	}
+	oWF := writerCfg.NewWriterFuncs(ccfg)
+
+	return cep.Db.View(func(tx *bbolt.Tx) error {
+
+		for _, pfx := range v.prefixes() {
+
+			sGaps, err := GapsTx(tx, PrefixSpan(pfx))
+			if err != nil {
+				return err
+			}
+
+			addrVer := "IPV4"
+			if pfx.Addr().Is6() {
+				addrVer = "IPV6"
+			}
+
+			for _, gap := range sGaps {
+				for _, gapPfx := range gap.Prefixes() {
+					parts := []interface{}{addrVer, gapPfx.String()}
+					if cep.PrependQuery {
+						parts = append([]interface{}{cep.Cmd}, parts...)
+					}
+					if _, err := oWF(os.Stdout, parts...); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+/*
+a /8 with smaller rows after its start, so that the key just before a
+query inside of it belongs to a row ending before the query.
+*/
+func overlapTestRows() []string {
+	return []string{
+		"arin|US|ipv4|10.0.0.0|16777216|20000101|allocated|ORG-BIG",
+		"arin|US|ipv4|10.5.0.0|256|20000101|assigned|ORG-A",
+		"arin|US|ipv4|10.6.0.0|256|20000101|reserved|",
+		"arin|US|ipv4|10.200.0.0|65536|20000101|assigned|ORG-B",
+		"ripencc|NL|ipv4|11.0.0.0|256|20000101|allocated|ORG-C",
+		"apnic|AU|ipv6|2001:db8::|32|20000101|allocated|ORG-V6BIG",
+		"apnic|AU|ipv6|2001:db8:1::|48|20000101|assigned|ORG-V6A",
+		"apnic|AU|ipv6|2001:db9::|48|20000101|assigned|ORG-V6B",
+	}
+}
+
+func TestOverlappingRowsTx(t *testing.T) {
+
+	db := newTestIndex(t, overlapTestRows())
+
+	tests := []struct {
+		within string
+		all    []string // reg-ids of all overlapping rows, in key order
+	}{
+		{"10.9.0.0/16", []string{"ORG-BIG"}},
+		{"10.6.0.128/25", []string{"ORG-BIG", ""}},
+		{"10.5.0.0/16", []string{"ORG-BIG", "ORG-A"}},
+		{"10.200.1.0/24", []string{"ORG-BIG", "ORG-B"}},
+		{"10.255.255.255/32", []string{"ORG-BIG"}},
+		{"10.0.0.0/8", []string{"ORG-BIG", "ORG-A", "", "ORG-B"}},
+		{"8.0.0.0/6", []string{"ORG-BIG", "ORG-A", "", "ORG-B", "ORG-C"}},
+		{"11.0.1.0/24", nil},
+		{"9.0.0.0/8", nil},
+		{"2001:db8:2::/48", []string{"ORG-V6BIG"}},
+		{"2001:db8:1:5::/64", []string{"ORG-V6BIG", "ORG-V6A"}},
+		{"2001:db9::/48", []string{"ORG-V6B"}},
+		{"2001:db9:1::/48", nil},
+	}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+
+		// largest rows: the /8 & the /32
+		if n4, n6 := MaxHostBitsTx(tx, false, AllStatusSet()), MaxHostBitsTx(tx, true, AllStatusSet()); (n4 != 24) || (n6 != 96) {
+			t.Errorf("max host bits %d & %d, want 24 & 96", n4, n6)
+		}
+
+		for _, tc := range tests {
+
+			within := PrefixSpan(netip.MustParsePrefix(tc.within))
+			var got []string
+			err := OverlappingRowsTx(tx, within, AllStatusSet(), func(row Row, span IpSpan) error {
+				if span.Last.Less(within.First) || within.Last.Less(span.First) {
+					t.Errorf("%s: row %s does not overlap", tc.within, row.RegId)
+				}
+				got = append(got, string(row.RegId))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if !reflect.DeepEqual(got, tc.all) {
+				t.Errorf("%s: got %q, want %q", tc.within, got, tc.all)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGapsTx(t *testing.T) {
+
+	db := newTestIndex(t, overlapTestRows())
+
+	tests := []struct {
+		within string
+		gaps   []string
+	}{
+		{"10.9.0.0/16", nil},
+		{"10.6.0.0/24", nil},
+		{"10.0.0.0/7", []string{"11.0.1.0-11.255.255.255"}},
+		{"9.0.0.0/8", []string{"9.0.0.0-9.255.255.255"}},
+		{"2001:db8:ffff::/48", nil},
+		{"2001:db9::/47", []string{"2001:db9:1::-2001:db9:1:ffff:ffff:ffff:ffff:ffff"}},
+	}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		for _, tc := range tests {
+
+			sGaps, err := GapsTx(tx, PrefixSpan(netip.MustParsePrefix(tc.within)))
+			if err != nil {
+				return err
+			}
+			var got []string
+			for _, gap := range sGaps {
+				got = append(got, gap.First.String()+"-"+gap.Last.String())
+			}
+			if !reflect.DeepEqual(got, tc.gaps) {
+				t.Errorf("%s: got %q, want %q", tc.within, got, tc.gaps)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReachFloor(t *testing.T) {
+
+	tests := []struct {
+		ip        string
+		nHostBits int
+		want      string
+	}{
+		{"10.9.0.0", 24, "9.0.0.0"},
+		{"10.0.0.0", 24, "9.0.0.0"},
+		{"0.1.2.3", 24, "0.0.0.0"},
+		{"10.9.1.1", 8, "10.9.0.0"},
+		{"10.9.1.1", 0, "10.9.1.0"},
+		{"10.9.1.1", 32, "0.0.0.0"},
+		{"2001:db8:1::", 96, "2001:db7::"},
+		{"::1", 128, "::"},
+	}
+
+	for _, tc := range tests {
+		if got := reachFloor(netip.MustParseAddr(tc.ip), tc.nHostBits); got != netip.MustParseAddr(tc.want) {
+			t.Errorf("%s, %d bits: got %s, want %s", tc.ip, tc.nHostBits, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math/bits"
+	"net/netip"
+	"sort"
+
+	"github.com/BourgeoisBear/range2cidr"
+)
+
+// inclusive range of addresses, of the same family
+type IpSpan struct {
+	First, Last netip.Addr
+}
+
+// last address inside of a prefix
+func PrefixLast(pfx netip.Prefix) netip.Addr {
+
+	pfx = pfx.Masked()
+	bs := pfx.Addr().AsSlice()
+	for ixBit := pfx.Bits(); ixBit < len(bs)*8; ixBit++ {
+		bs[ixBit/8] |= 0x80 >> (ixBit % 8)
+	}
+	ret, _ := netip.AddrFromSlice(bs)
+	return ret
+}
+
+func PrefixSpan(pfx netip.Prefix) IpSpan {
+	return IpSpan{First: pfx.Masked().Addr(), Last: PrefixLast(pfx)}
+}
+
+// address range covered by a delegation row
+func RowSpan(pR *Row) (IpSpan, bool) {
+	if len(pR.IpRange) == 0 {
+		return IpSpan{}, false
+	}
+	return IpSpan{
+		First: pR.IpRange[0].Addr(),
+		Last:  PrefixLast(pR.IpRange[len(pR.IpRange)-1]),
+	}, true
+}
+
+func (s IpSpan) Contains(ip netip.Addr) bool {
+	return (s.First.Compare(ip) <= 0) && (ip.Compare(s.Last) <= 0)
+}
+
+// low-order bits of the smallest prefix covering the span
+func (s IpSpan) HostBits() int {
+	bsFirst, bsLast := s.First.AsSlice(), s.Last.AsSlice()
+	for ix := range bsFirst {
+		if bx := bsFirst[ix] ^ bsLast[ix]; bx != 0 {
+			return (len(bsFirst)-ix)*8 - bits.LeadingZeros8(bx)
+		}
+	}
+	return 0
+}
+
+func (s IpSpan) Prefixes() []netip.Prefix {
+	ret, _ := range2cidr.Deaggregate(s.First, s.Last)
+	return ret
+}
+
+// sort, then join overlapping & adjacent spans
+func MergeSpans(sSpans []IpSpan) []IpSpan {
+
+	if len(sSpans) == 0 {
+		return nil
+	}
+
+	sort.Slice(sSpans, func(i, j int) bool {
+		return sSpans[i].First.Less(sSpans[j].First)
+	})
+
+	ret := []IpSpan{sSpans[0]}
+	for _, s := range sSpans[1:] {
+
+		pLast := &ret[len(ret)-1]
+		next := pLast.Last.Next()
+
+		// overlapping/adjacent (an invalid next means pLast reaches the top)
+		if !next.IsValid() || (s.First.Compare(next) <= 0) {
+			if s.Last.Compare(pLast.Last) > 0 {
+				pLast.Last = s.Last
+			}
+			continue
+		}
+
+		ret = append(ret, s)
+	}
+
+	return ret
+}
+
+// parts of within not covered by any of sCovered (sorted & merged)
+func SubtractSpans(within IpSpan, sCovered []IpSpan) []IpSpan {
+
+	var ret []IpSpan
+	cur := within.First
+	for _, c := range sCovered {
+
+		if c.Last.Less(cur) {
+			continue
+		}
+		if within.Last.Less(c.First) {
+			break
+		}
+
+		if cur.Less(c.First) {
+			ret = append(ret, IpSpan{First: cur, Last: c.First.Prev()})
+		}
+
+		// covered through the end of the address space
+		cur = c.Last.Next()
+		if !cur.IsValid() || within.Last.Less(cur) {
+			return ret
+		}
+	}
+
+	return append(ret, IpSpan{First: cur, Last: within.Last})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// "1.0.0.0-1.0.0.255 2.0.0.0-2.0.0.0" to spans
+func parseSpans(t *testing.T, sz string) []IpSpan {
+
+	var ret []IpSpan
+	for _, szSpan := range strings.Fields(sz) {
+		szFirst, szLast, _ := strings.Cut(szSpan, "-")
+		ret = append(ret, IpSpan{
+			First: netip.MustParseAddr(szFirst),
+			Last:  netip.MustParseAddr(szLast),
+		})
+	}
+	return ret
+}
+
+func TestMergeSpans(t *testing.T) {
+
+	tests := []struct {
+		name, in, want string
+	}{
+		{"empty", "", ""},
+		{"single", "1.0.0.0-1.0.0.255", "1.0.0.0-1.0.0.255"},
+		{"disjoint", "3.0.0.0-3.0.0.255 1.0.0.0-1.0.0.255", "1.0.0.0-1.0.0.255 3.0.0.0-3.0.0.255"},
+		{"adjacent", "1.0.1.0-1.0.1.255 1.0.0.0-1.0.0.255", "1.0.0.0-1.0.1.255"},
+		{"gap of one", "1.0.0.0-1.0.0.254 1.0.1.0-1.0.1.255", "1.0.0.0-1.0.0.254 1.0.1.0-1.0.1.255"},
+		{"overlapping", "1.0.0.0-1.0.0.200 1.0.0.100-1.0.1.0", "1.0.0.0-1.0.1.0"},
+		{"contained", "1.0.0.0-1.255.255.255 1.2.0.0-1.2.255.255 1.0.0.0-1.0.0.0", "1.0.0.0-1.255.255.255"},
+		{"chain", "1.0.0.2-1.0.0.2 1.0.0.0-1.0.0.0 1.0.0.1-1.0.0.1 1.0.0.4-1.0.0.9", "1.0.0.0-1.0.0.2 1.0.0.4-1.0.0.9"},
+		{"top of v4", "255.255.255.0-255.255.255.255 255.255.255.128-255.255.255.255", "255.255.255.0-255.255.255.255"},
+		{"top of v6", "ffff::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff ffff:ffff::-ffff:ffff::1", "ffff::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{"v6", "2001:db8:1::-2001:db8:1:ffff:ffff:ffff:ffff:ffff 2001:db8::-2001:db8:0:ffff:ffff:ffff:ffff:ffff", "2001:db8::-2001:db8:1:ffff:ffff:ffff:ffff:ffff"},
+	}
+
+	for _, tc := range tests {
+		got := MergeSpans(parseSpans(t, tc.in))
+		if want := parseSpans(t, tc.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, want)
+		}
+	}
+}
+
+func TestSubtractSpans(t *testing.T) {
+
+	tests := []struct {
+		name, within, covered, want string
+	}{
+		{"nothing covered", "1.0.0.0-1.0.0.255", "", "1.0.0.0-1.0.0.255"},
+		{"all covered", "1.0.0.0-1.0.0.255", "1.0.0.0-1.0.0.255", ""},
+		{"covered beyond", "1.0.0.10-1.0.0.20", "1.0.0.0-1.0.0.255", ""},
+		{"head covered", "1.0.0.0-1.0.0.255", "0.0.0.0-1.0.0.127", "1.0.0.128-1.0.0.255"},
+		{"tail covered", "1.0.0.0-1.0.0.255", "1.0.0.128-2.0.0.0", "1.0.0.0-1.0.0.127"},
+		{"middle covered", "1.0.0.0-1.0.0.255", "1.0.0.64-1.0.0.127", "1.0.0.0-1.0.0.63 1.0.0.128-1.0.0.255"},
+		{"holes", "1.0.0.0-1.0.0.255", "1.0.0.1-1.0.0.1 1.0.0.3-1.0.0.254", "1.0.0.0-1.0.0.0 1.0.0.2-1.0.0.2 1.0.0.255-1.0.0.255"},
+		{"outside", "1.0.0.0-1.0.0.255", "0.0.0.0-0.255.255.255 2.0.0.0-2.0.0.255", "1.0.0.0-1.0.0.255"},
+		{"to top of v4", "255.255.255.0-255.255.255.255", "255.255.255.128-255.255.255.255", "255.255.255.0-255.255.255.127"},
+		{"v6", "2001:db8::-2001:db8::ff", "2001:db8::10-2001:db8::1f", "2001:db8::-2001:db8::f 2001:db8::20-2001:db8::ff"},
+	}
+
+	for _, tc := range tests {
+		within := parseSpans(t, tc.within)[0]
+		got := SubtractSpans(within, parseSpans(t, tc.covered))
+		if want := parseSpans(t, tc.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, want)
+		}
+	}
+}
+
+func TestHostBits(t *testing.T) {
+
+	tests := []struct {
+		span string
+		want int
+	}{
+		{"1.2.3.4-1.2.3.4", 0},
+		{"1.2.3.0-1.2.3.255", 8},
+		{"1.0.1.0-1.0.3.255", 10},
+		{"1.2.3.255-1.2.4.0", 11},
+		{"0.0.0.0-255.255.255.255", 32},
+		{"10.0.0.0-10.255.255.255", 24},
+		{"2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", 96},
+		{"::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 128},
+	}
+
+	for _, tc := range tests {
+		if got := parseSpans(t, tc.span)[0].HostBits(); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.span, got, tc.want)
+		}
+	}
+}
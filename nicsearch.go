@@ -8,19 +8,25 @@ package main
 */
 
 import (
+	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"net/netip"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/BourgeoisBear/nicsearch/rdap"
 	"github.com/chzyer/readline"
 	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
 	"go.etcd.io/bbolt"
 )
 
@@ -100,8 +106,41 @@ func main() {
 	flag.BoolVar(&bDownload, "download", false, "force download of RIR databases")
 	flag.BoolVar(&mode.Color, "color", bIsTty, "force color output on/off")
 	flag.BoolVar(&mode.Pretty, "pretty", bIsTty, "force pretty print on/off")
+	flag.BoolVar(&mode.AsDot, "asdot", false, "print 32-bit ASNs in asdot notation (e.g. 1.10)")
 	flag.BoolVar(&mode.PrependQuery, "prependQuery", false, "prepend query to corresponding result row in tabular outputs")
-	flag.StringVar(&dbPath, "dbpath", dbPath, "override path to RIR data and index")
+	flag.StringVar(&mode.DbPath, "dbpath", dbPath, "override path to RIR data and index")
+
+	mode.Statuses = DefaultStatusSet()
+	flag.Var(statusFlag{&mode.Statuses}, "include-status", "also report delegations with these comma-separated statuses (`reserved,available`, or 'all')")
+	flag.StringVar(&mode.WatchCmd, "watchcmd", "", "shell command to run (JSON report on stdin) when watched queries change")
+	flag.StringVar(&mode.WatchURL, "watchurl", "", "webhook URL to POST JSON report to when watched queries change")
+
+	flag.DurationVar(&mode.RdapTTL, "rdapTTL", 24*time.Hour, "time to keep cached RDAP responses")
+	flag.BoolVar(&mode.Offline, "offline", false, "answer 'rdap.' queries only from the RDAP cache")
+
+	mode.Rdap = rdap.NewClient()
+	flag.DurationVar(&mode.Rdap.RequestInterval, "rdapInterval", mode.Rdap.RequestInterval, "minimum time between requests to the same RDAP server")
+	flag.DurationVar(&mode.Rdap.HTTP.Timeout, "rdapTimeout", mode.Rdap.HTTP.Timeout, "time limit of each RDAP request")
+	flag.IntVar(&mode.Rdap.MaxReferrals, "rdapReferrals", mode.Rdap.MaxReferrals, "redirects & cross-registry referrals followed per RDAP query")
+	flag.StringVar(&mode.Rdap.UserAgent, "userAgent", mode.Rdap.UserAgent, "User-Agent header of RDAP requests")
+	flag.StringVar(&mode.Rdap.BootstrapUrl, "bootstrapURL", rdap.BootstrapBaseUrl, "location of IANA RDAP bootstrap registries")
+	flag.Var(rdapBaseFlag{mode.Rdap}, "rdapBase", "override RDAP service of RIRs (`rir=url,...`), e.g. 'arin=http://localhost:8080'")
+	var szProxy string
+	var bRdapStrict bool
+	flag.BoolVar(&bRdapStrict, "rdapStrict", false, "fail on malformed RDAP responses, rather than skipping what cannot be parsed")
+	flag.StringVar(&szProxy, "proxy", "", "send RDAP requests through proxy `URL` (default from HTTP_PROXY/HTTPS_PROXY)")
+
+	var szAsOf, szBackfill string
+	flag.StringVar(&szAsOf, "asof", "", "answer local queries from the delegation snapshot nearest to `YYYY-MM-DD`")
+	flag.StringVar(&szBackfill, "backfill", "", "download archived RIR delegations for `YYYY-MM-DD` into the snapshot directory")
+
+	var szBulkFile string
+	var nWorkers int
+	flag.StringVar(&szBulkFile, "f", "", "bulk mode: lookup one IP or ASN per line of `FILE` ('-' for stdin), writing results in input order")
+	flag.IntVar(&nWorkers, "workers", runtime.NumCPU(), "number of concurrent lookup workers in bulk mode")
+
+	var szAnnotate string
+	flag.StringVar(&szAnnotate, "annotate", "", "annotate mode: copy stdin to stdout, labeling each IP address found ('inline' or 'append')")
 
 	var iWri io.Writer = os.Stdout
 	flag.CommandLine.SetOutput(iWri)
@@ -109,6 +148,9 @@ func main() {
 
 		fmt.Fprint(iWri, `USAGE
   nicsearch [OPTION]... [QUERY]...
+  nicsearch [OPTION]... enrich -field FIELD [-in FILE] [-format csv|ndjson]
+  nicsearch [OPTION]... stats [-in FILE] [-top N] [-unique]
+  nicsearch [OPTION]... report -tmpl FILE [-in FILE] [-out DIR]
 
     Offline lookup by IP/ASN of other IPs/ASNs owned by the same organization.
     This tool can also dump IPs/ASNs by country code, as well as map most ASNs to
@@ -122,21 +164,43 @@ OPTION
 		fmt.Fprint(iWri, `
 QUERY
   as ASN [+]
-    query by autonomous system number (ASN).
+    query by autonomous system number (ASN), in asplain, asdot,
+    or AS-prefixed notation.  special-purpose ASNs (private use,
+    documentation, AS_TRANS, reserved) are explained.
       ex: 'as 14061'
+      ex: 'as AS14061'
+      ex: 'as 1.10'
 
     add the suffix '+' to return all IPs and ASNs associated
     by 'reg-id' with the same organization.
       ex: 'as 14061 +'
 
   ip IPADDR [+]
-    query by IP (v4 or v6) address.
+    query by IP (v4 or v6) address.  addresses inside of IANA
+    special-purpose blocks (private-use, documentation, CGNAT,
+    multicast, 6to4, etc.) also report the matching block.
+    IPv4 addresses embedded in 6to4, Teredo, NAT64 & IPv4-mapped
+    IPv6 addresses are looked up as well.
       ex: 'ip 172.104.6.84'
 
+    IPADDR may also carry a port ('1.2.3.4:443', '[2001:db8::1]:80'),
+    be a decimal or hex integer ('16909060', '0x01020304'), have
+    zero-padded octets ('001.002.003.004'), or be defanged
+    ('1[.]2[.]3[.]4').  this applies to all IPADDR arguments.
+
     add the suffix '+' to return all IPs and ASNs associated
     by 'reg-id' with the same organization.
       ex: 'ip 172.104.6.84 +'
 
+  net PREFIX [+]
+    query by network prefix.  returns all delegations overlapping
+    with PREFIX.
+      ex: 'net 104.16.0.0/13'
+
+    add the suffix '+' to return all IPs and ASNs associated
+    by 'reg-id' with the same organization(s).
+      ex: 'net 104.16.0.0/13 +'
+
   cc COUNTRY_CODE
     query by country code.
     returns all IPs & ASNs for the given country.
@@ -159,10 +223,48 @@ QUERY
     NOTE: columns are separated by '@@' instead of '|' since pipe can
           appear inside the unquoted local-part of an email address.
 
-  rdap.ip RIR IPADDR
-    get full RDAP reply (in JSON) from RIR for IP address.
+  rdap.ip [RIR] IPADDR
+    get full RDAP reply (in JSON) for IP address.  without RIR, the
+    RDAP service is picked from the IANA bootstrap registries (RFC 9224,
+    cached in DBPATH for a day), or else from the RIR of the local
+    delegation.
+      ex: 'rdap.ip 8.8.8.8'
       ex: 'rdap.ip arin 8.8.8.8'
 
+  rdap.as ASN
+    get full RDAP reply (in JSON) for an autonomous system.  the RDAP
+    service is picked by the RIR of the local ASN delegation, or else
+    from the IANA bootstrap registries.
+      ex: 'rdap.as 15169'
+
+  rdap.asinfo ASN
+    an 'rdap.as' query, in table format: handle, name, country, status
+    & range of the autonomous system, followed by its contacts.
+      ex: 'rdap.asinfo AS15169'
+
+  rdap.contacts IPADDR|ASN [json]
+    contact cards of all entities in the RDAP reply for IPADDR or ASN:
+    roles, handle, name, organization, email, telephone (with types)
+    & address.  as a table, or in JSON with 'json'.
+      ex: 'rdap.contacts 8.8.8.8'
+      ex: 'rdap.contacts AS15169 json'
+
+  rdap.abuse IPADDR|ASN [json]
+    best abuse contact for IPADDR or ASN, with where it was found: an
+    entity with role 'abuse', else an 'abuse-mailbox' remark (RIPE &
+    APNIC), looked for in the queried object, then up through its parent
+    networks.  when none has one, a technical, administrative or
+    registrant contact is reported instead, with RULE 'fallback'.
+
+      EMAIL|HANDLE|NAME|RULE|OBJECT|LVL|URL
+
+      ex: 'rdap.abuse 8.8.8.8'
+      ex: 'rdap.abuse AS15169 json'
+
+  rdap.purge [expired]
+    remove all (or only expired) responses from the RDAP cache.
+      ex: 'rdap.purge expired'
+
   rdap.org RIR ORGID
     get full RDAP reply (in JSON) from RIR for ORGID.
       ex: 'rdap.org arin DO-13'
@@ -172,20 +274,188 @@ QUERY
     section in table format.
       ex: 'rdap.orgnets arin DO-13'
 
+  st STATUS[,STATUS]... [COUNTRY_CODE]
+    query by delegation status (allocated, assigned, reserved,
+    available, or all), optionally limited to a country code.
+    by default, other queries only report allocated & assigned
+    delegations (see -include-status).
+      ex: 'st reserved'
+      ex: 'st available,reserved ZZ'
+
   all
     dump all local records
 
+  gaps [PREFIX]
+    list address ranges inside of PREFIX (or inside of the whole IPv4
+    & IPv6 spaces, when omitted) without an allocated or assigned
+    delegation from any RIR.
+      ex: 'gaps 23.0.0.0/8'
+
+  bogons [PREFIX]
+    list bogon ranges inside of PREFIX (or inside of the whole IPv4 &
+    IPv6 spaces, when omitted): undelegated space, combined with
+    special-purpose blocks that are not globally reachable.
+      ex: 'bogons'
+
+  diff FROM [TO]
+    compare two sets of RIR delegations, reporting new & returned
+    resources, as well as country, status, reg-id, and size changes per
+    registry.  FROM & TO are either 'current' (the default TO) or a
+    YYYY-MM-DD date, which selects the nearest snapshot.  registries
+    missing from either side are reported, but not compared.  changes
+    are listed for resources of a reported status (see -include-status)
+    on either side, so e.g. allocations turned reserved are STATUS changes.
+      ex: 'diff 2024-01-01'
+      ex: 'diff 2023-01-01 2024-01-01'
+
+  watch add QUERY
+    add an 'as', 'ip', 'net', 'cc', 'na' or 'st' QUERY to the persisted watchlist.
+    watched queries are re-evaluated after every download/reindex
+    (or rebuild of an outdated index), and added (+) or removed (-)
+    rows of any status are reported.  see -watchcmd and -watchurl
+    for change notifications.  the watchlist is read-only under -asof.
+      ex: 'watch add as 14061 +'
+
+  watch rm QUERY
+    remove QUERY from the watchlist.
+      ex: 'watch rm as 14061 +'
+
+  watch ls
+    list watched queries.
+
+  watch check
+    re-evaluate watched queries now.
+
+  BARE QUERIES
+    a query without a command is interpreted by its form, whois-style:
+    IP addresses as 'ip', prefixes as 'net', AS-prefixed, asdot or bare
+    integers as 'as', and two letters as 'cc'.  the '+' suffix applies.
+      ex: '8.8.8.8', 'AS13335 +', '2001:4860::', '192.0.2.0/24', 'US'
+
+  NOTE: each download of RIR delegations is also kept as a dated
+        snapshot under DBPATH/snapshots.  use '-backfill YYYY-MM-DD'
+        to fetch older snapshots from the RIR archives, then
+        '-asof YYYY-MM-DD' to answer 'as', 'ip', 'cc', 'na' & 'all'
+        queries from the snapshot nearest that date.  a snapshot of
+        that very day is always used; otherwise, snapshots missing any
+        RIR's delegations are passed over for complete ones up to 7
+        days away.  other days & missing delegations are warned of.
+
   NOTE: all 'rdap.' queries require an internet connection to the
-        RIR's RDAP service.`)
+        RIR's RDAP service.  responses are cached in DBPATH/rdapcache.db
+        for -rdapTTL, and IP replies for end-user assignments answer later
+        queries for any address inside of them.  -offline answers from
+        cache only.
+
+        requests are spaced per RDAP server by -rdapInterval.  throttled
+        (429) requests are retried after the server's Retry-After, and
+        transient server errors (5xx) with exponential backoff.
+
+        -rdapTimeout, -userAgent & -proxy configure RDAP requests, and
+        -rdapBase & -bootstrapURL point them at other servers (e.g. a
+        local stand-in for testing).  Ctrl-C cancels a running query.
+
+        HTTP redirects & 'related'/'up' links to the same kind of object
+        on another server (e.g. for space transferred between RIRs) are
+        followed, up to -rdapReferrals.  the server giving the final
+        answer is reported on stderr.
+
+        malformed parts of RDAP responses (e.g. odd vCards) are skipped,
+        or reported as errors with -rdapStrict.
+
+BULK MODE
+  -f FILE reads one bare IP address or ASN per line (blank lines & lines
+  starting with '#' are skipped), and writes one result row per line, in
+  input order:
+
+    QRY|RIR|CC|TYPE|RESOURCE|DATE|STS|NAME
+
+  lookups run concurrently over shared read transactions (see -workers).
+  unmatched & invalid lines are reported on stderr.
+    ex: zcat access.log.gz | cut -d' ' -f1 | nicsearch -f -
+
+ANNOTATE MODE
+  -annotate inline|append copies arbitrary text (syslog, web server &
+  firewall logs) from stdin to stdout, labeling every IPv4 & IPv6 address
+  found with its organization's ASN & name, country code, and RIR:
+
+    inline: 'GET from 8.8.8.8 [AS15169 GOOGLE US arin] ...'
+    append: 'GET from 8.8.8.8 ... [8.8.8.8 AS15169 GOOGLE US arin]'
+
+  undelegated special-purpose addresses are labeled with their block name.
+  output is flushed as soon as input is idle.
+    ex: tail -f /var/log/nginx/access.log | nicsearch -annotate inline
+
+ENRICH
+  enrich -field FIELD [-in FILE] [-format csv|ndjson]
+    append delegation columns to each record of a dataset, by the IP
+    address in FIELD:
+
+      nic_registry, nic_cc, nic_subnet, nic_asn, nic_asname, nic_regid
+
+    CSV input needs a header row; FIELD names the IP column.  records
+    shorter than the header are padded, longer ones are an error.  NDJSON
+    input (.json, .jsonl & .ndjson files) takes a dotted key path as
+    FIELD, and gets the columns as added keys.  FILE defaults to stdin,
+    and the result goes to stdout.
+      ex: nicsearch enrich -in data.csv -field src_ip
+      ex: nicsearch enrich -in events.ndjson -field source.ip
+
+STATS
+  stats [-in FILE] [-top N] [-unique]
+    break down a list of IP addresses (one per line, from FILE or stdin)
+    by country, registry, ASN, and organization (registry:reg-id), with
+    counts & percentages of matched addresses.  each table is limited to
+    the top N (default 10) rows.  -unique counts each distinct address
+    once.  totals are reported on stderr.
+
+      BY|KEY|COUNT|PCT|NAME
+
+      ex: cut -d' ' -f1 access.log | nicsearch stats -top 20
+
+ABUSE REPORTS
+  report -tmpl FILE [-in FILE] [-out DIR]
+    group the log lines of FILE (or stdin) by the abuse contact of the
+    first IP address in each, as found by 'rdap.abuse', and render one
+    report per contact from the text/template FILE given by -tmpl: to
+    stdout, or into DIR as EMAIL.txt.  RDAP lookups are made once per
+    network.  lines without an address are skipped, and timestamps
+    (ISO 8601, common log or syslog format) are picked from each line.
+
+    template data:
+
+      .To           abuse email address
+      .Contact      .Handle .Name .Rule .Object .Level .URL (see rdap.abuse)
+      .Networks     handles of the networks holding the addresses
+      .Generated    time.Time of the report
+      .IPs          addresses, in order, each with:
+        .IP           address
+        .FirstSeen    first timestamp logged
+        .LastSeen     last timestamp logged
+        .Events       evidence, each with .Time & .Line
+
+    functions 'join', 'lower' & 'upper' are available.
+
+      ex: nicsearch report -tmpl abuse.tmpl -in fail2ban.log -out reports`)
 
 		fmt.Fprint(iWri, "\n")
 	}
 
 	flag.Parse()
+	dbPath = mode.DbPath
+	defer closeRdapCache()
+
+	mode.Rdap.Strict = bRdapStrict
+	mode.Rdap.Offline = mode.Offline
+	if len(szProxy) > 0 {
+		if E = mode.Rdap.SetProxy(szProxy); E != nil {
+			return
+		}
+	}
 
 	// immediate exit on user-specified reindex/download without arg queries
 	bExitOnCompletion := false
-	if (bReIndex || bDownload) && (len(flag.Args()) == 0) {
+	if (bReIndex || bDownload || (len(szBackfill) > 0)) && (len(flag.Args()) == 0) {
 		bExitOnCompletion = true
 	}
 
@@ -220,6 +490,7 @@ QUERY
 		return mode.AnsiMsg(os.Stderr, "NOT FOUND", fname, []uint8{1, 91})
 	}
 	// download delegations from each RIR & ASN list from RIPE
+	tStart := time.Now()
 	for _, item := range sFiles {
 		if bDownload || !Exists(item.DstPath) {
 			if !bDownload {
@@ -228,6 +499,11 @@ QUERY
 			if E = mode.DownloadAll(os.Stderr, item, dbPath); E != nil {
 				return
 			}
+			if item != asnFile {
+				if E = SaveSnapshot(dbPath, item.DstPath, tStart); E != nil {
+					return
+				}
+			}
 			bReIndex = true
 		}
 	}
@@ -239,52 +515,144 @@ QUERY
 		bReIndex = true
 	}
 
-	// init boltdb
-	if bReIndex {
-		os.Remove(boltDbFname)
+	// index current delegations
+	sDelegations := make([]string, 0, len(mDlItems))
+	for key := range mDlItems {
+		sDelegations = append(sDelegations, mDlItems[key].DstPath)
 	}
-	db, E := bbolt.Open(boltDbFname, 0664, nil)
+	db, bRebuilt, E := mode.OpenIndex(boltDbFname, bReIndex, sDelegations, asnFile.DstPath)
 	if E != nil {
 		return
 	}
 	defer db.Close()
 
-	// rebuild index
-	if bReIndex {
+	// re-evaluate watchlist on fresh (or freshly indexed) data
+	if bRebuilt {
+		if _, E = mode.CheckWatchlist(db); E != nil {
+			return
+		}
+	}
 
-		// create buckets
-		pBkt, err := CreateBktFiller(db)
+	// fetch archived delegations
+	if len(szBackfill) > 0 {
+		day, err := time.Parse("2006-01-02", szBackfill)
+		if err != nil {
+			E = errors.WithMessage(err, "invalid -backfill date")
+			return
+		}
+		if E = mode.Backfill(dbPath, day); E != nil {
+			return
+		}
+	}
+
+	if bExitOnCompletion {
+		return
+	}
+
+	// swap in index of snapshot nearest to requested date
+	if len(szAsOf) > 0 {
+
+		asOf, err := time.Parse("2006-01-02", szAsOf)
+		if err != nil {
+			E = errors.WithMessage(err, "invalid -asof date")
+			return
+		}
+
+		day, err := mode.nearestSnapshot(asOf)
 		if err != nil {
 			E = err
 			return
 		}
+		mode.AnsiMsg(os.Stderr, "AS OF", day.Format("2006-01-02"), []uint8{1, 96})
 
-		fnIndexing := func(fname string) (int, error) {
-			return mode.AnsiMsg(os.Stderr, "INDEXING", fname, []uint8{1, 93})
+		sSnapFiles, err := SnapshotFiles(dbPath, day)
+		if err != nil {
+			E = err
+			return
 		}
 
-		// fill from sources
-		for key := range mDlItems {
-			fname := mDlItems[key].DstPath
-			fnIndexing(fname)
-			if E = pBkt.GzRead(fname, pBkt.scanlnDelegation); E != nil {
-				return
-			}
+		snapDbFname := filepath.Join(SnapshotDayDir(dbPath, day), "nicsearch.db")
+		dbSnap, _, err := mode.OpenIndex(
+			snapDbFname,
+			bReIndex || !Exists(snapDbFname),
+			sSnapFiles,
+			asnFile.DstPath,
+		)
+		if err != nil {
+			E = err
+			return
 		}
+		defer dbSnap.Close()
+		db = dbSnap
+		mode.AsOf = day
+	}
 
-		// fill ASN lookup
-		fname := asnFile.DstPath
-		fnIndexing(fname)
-		E = pBkt.GzRead(fname, pBkt.scanlnAsName)
+	// sub-commands
+	if len(flag.Args()) > 0 {
+		switch strings.ToLower(flag.Arg(0)) {
+		case "enrich":
+			E = mode.Enrich(db, flag.Args()[1:])
+			return
+		case "stats":
+			E = mode.Stats(db, flag.Args()[1:])
+			return
+		case "report":
+			E = mode.AbuseReports(db, flag.Args()[1:])
+			return
+		}
+	}
+
+	// free-text annotation
+	if len(szAnnotate) > 0 {
 
-		if bExitOnCompletion {
+		bAppend, err := ParseAnnotateMode(szAnnotate)
+		if err != nil {
+			E = err
 			return
 		}
+
+		pA := &Annotator{Modes: &mode, Db: db, Append: bAppend}
+		E = pA.Run(os.Stdin, os.Stdout)
+		return
+	}
+
+	// bulk lookups
+	if len(szBulkFile) > 0 {
+
+		var iRd io.Reader = os.Stdin
+		if szBulkFile != "-" {
+			pF, err := os.Open(szBulkFile)
+			if err != nil {
+				E = err
+				return
+			}
+			defer pF.Close()
+			iRd = pF
+		}
+
+		E = mode.RunBulk(db, iRd, nWorkers)
+		return
 	}
 
 	// command REPL
 	sCmds := flag.Args()
-	if len(sCmds) == 0 {
+	if (len(sCmds) == 0) && !isatty.IsTerminal(os.Stdin.Fd()) {
+
+		// piped command mode, without line editing
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			line := sc.Text()
+			bContinue, e2 := mode.doREPL(db, line, utf8.RuneCountInString(line))
+			if e2 != nil {
+				mode.printErr(e2, line)
+			}
+			if !bContinue || errors.Is(e2, context.Canceled) {
+				break
+			}
+		}
+		E = sc.Err()
+
+	} else if len(sCmds) == 0 {
 
 		// stdin command mode
 		rl, e2 := readline.New("> ")
@@ -328,7 +696,7 @@ QUERY
 			if e2 != nil {
 				mode.printErr(e2, sCmds[ix])
 			}
-			if !bContinue {
+			if !bContinue || errors.Is(e2, context.Canceled) {
 				break
 			}
 		}
@@ -337,6 +705,67 @@ QUERY
 	return
 }
 
+/*
+open bolt index, (re)building from delegation & ASN name files if needed.
+true when it was (re)built, by request or for being outdated.
+*/
+func (m *Modes) OpenIndex(
+	dbFname string, bReIndex bool, sDelegations []string, asnFname string,
+) (*bbolt.DB, bool, error) {
+
+	if bReIndex {
+		os.Remove(dbFname)
+	}
+
+	db, err := bbolt.Open(dbFname, 0664, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !bReIndex {
+
+		if IsIndexCurrent(db) {
+			return db, false, nil
+		}
+
+		// rebuild indexes from older versions
+		db.Close()
+		m.AnsiMsg(os.Stderr, "OUTDATED", dbFname, []uint8{1, 91})
+		return m.OpenIndex(dbFname, true, sDelegations, asnFname)
+	}
+
+	fnIndexing := func(fname string) (int, error) {
+		return m.AnsiMsg(os.Stderr, "INDEXING", fname, []uint8{1, 93})
+	}
+
+	err = func() error {
+
+		// create buckets
+		pBkt, err := CreateBktFiller(db)
+		if err != nil {
+			return err
+		}
+
+		// fill from sources
+		for _, fname := range sDelegations {
+			fnIndexing(fname)
+			if err = pBkt.GzRead(fname, pBkt.scanlnDelegation); err != nil {
+				return err
+			}
+		}
+
+		// fill ASN lookup
+		fnIndexing(asnFname)
+		return pBkt.GzRead(asnFname, pBkt.scanlnAsName)
+	}()
+
+	if err != nil {
+		db.Close()
+		return nil, false, err
+	}
+	return db, true, nil
+}
+
 func (m *Modes) printErr(err error, query string) (int, error) {
 	if err == nil {
 		return 0, nil
@@ -357,9 +786,14 @@ func (m *Modes) doREPL(db *bbolt.DB, szCmd string, maxCmdLen int) (bool, error)
 		return true, err
 	}
 
+	// Ctrl-C cancels the running query, rather than the program
+	ctx, fnStop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer fnStop()
+
 	return true, iCmd.Exec(
 		CmdExecParams{
 			Modes:     *m,
+			Ctx:       ctx,
 			Db:        db,
 			Cmd:       szCmd,
 			MaxCmdLen: uint16(maxCmdLen),
@@ -367,18 +801,140 @@ func (m *Modes) doREPL(db *bbolt.DB, szCmd string, maxCmdLen int) (bool, error)
 	)
 }
 
-func rdapByIp(db *bbolt.DB, ip netip.Addr) ([]byte, error) {
+var (
+	g_bootstrap    *rdap.Bootstrap
+	g_bootstrapErr error
+)
 
-	row, err := IpToRow(db, ip)
+// RFC 9224 bootstrap registries, loaded (at most) once per run.  transient
+// failures (e.g. Ctrl-C, timeouts) are retried on next use.
+func (m *Modes) rdapBootstrap(ctx context.Context) (*rdap.Bootstrap, error) {
+
+	if (g_bootstrap != nil) || (g_bootstrapErr != nil) {
+		return g_bootstrap, g_bootstrapErr
+	}
+
+	pB, err := m.Rdap.LoadBootstrap(ctx, m.DbPath, 24*time.Hour)
 	if err != nil {
+		if !rdap.IsTransient(err) {
+			g_bootstrapErr = err
+		}
 		return nil, err
 	}
+	g_bootstrap = pB
+	return pB, nil
+}
+
+// RDAP service for ip, from bootstrap registries, else from the RIR of
+// its local delegation
+func (m *Modes) rdapBaseForIP(ctx context.Context, db *bbolt.DB, ip netip.Addr) (string, error) {
+
+	pB, errBoot := m.rdapBootstrap(ctx)
+	if errBoot == nil {
+		if base, ok := pB.BaseForIP(ip); ok {
+			return m.Rdap.Rebase(base), nil
+		}
+	}
 
-	szReg := string(row.Registry)
-	rk, err := rdap.RegistryNameToKey(szReg)
+	row, err := IpToRow(db, ip, m.Statuses)
+	if err != nil {
+		if errBoot != nil {
+			return "", errBoot
+		}
+		return "", err
+	}
+
+	rk, err := rdap.RegistryNameToKey(string(row.Registry))
+	if err != nil {
+		return "", err
+	}
+	return m.Rdap.BaseUrl(rk), nil
+}
+
+// RDAP service for an ASN, from the RIR of its local delegation, else
+// from bootstrap registries
+func (m *Modes) rdapBaseForASN(ctx context.Context, db *bbolt.DB, nASN uint32) (string, error) {
+
+	if row, err := AsnToRow(db, nASN); err == nil {
+		if rk, err := rdap.RegistryNameToKey(string(row.Registry)); err == nil {
+			return m.Rdap.BaseUrl(rk), nil
+		}
+	}
+
+	pB, err := m.rdapBootstrap(ctx)
+	if err != nil {
+		return "", err
+	}
+	if base, ok := pB.BaseForASN(nASN); ok {
+		return m.Rdap.Rebase(base), nil
+	}
+	return "", ENotFound
+}
+
+func (m *Modes) rdapByIp(ctx context.Context, db *bbolt.DB, ip netip.Addr) ([]byte, error) {
+
+	base, err := m.rdapBaseForIP(ctx, db, ip)
 	if err != nil {
 		return nil, err
 	}
+	return m.rdapGetIP(ctx, base, ip)
+}
+
+// RDAP reply for an IP or ASN, and the URL queried
+func (m *Modes) rdapByTarget(ctx context.Context, db *bbolt.DB, tgt RdapTarget) (string, []byte, error) {
 
-	return rdap.QueryByIP(rk, ip)
+	if !tgt.HasASN {
+		base, err := m.rdapBaseForIP(ctx, db, tgt.IP)
+		if err != nil {
+			return "", nil, err
+		}
+		bsJSON, err := m.rdapGetIP(ctx, base, tgt.IP)
+		return rdap.IPUrl(base, tgt.IP), bsJSON, err
+	}
+
+	base, err := m.rdapBaseForASN(ctx, db, tgt.ASN)
+	if err != nil {
+		return "", nil, err
+	}
+	url := rdap.ASNUrl(base, tgt.ASN)
+	bsJSON, err := m.rdapGet(ctx, url)
+	return url, bsJSON, err
+}
+
+// -rdapBase flag: comma-separated RIR=URL overrides of RDAP services
+type rdapBaseFlag struct {
+	pC *rdap.Client
+}
+
+func (bf rdapBaseFlag) String() string {
+	if (bf.pC == nil) || (len(bf.pC.BaseUrls) == 0) {
+		return ""
+	}
+	var parts []string
+	for rk := rdap.RIRKey(0); rk < rdap.RkMAX; rk++ {
+		if base, ok := bf.pC.BaseUrls[rk]; ok {
+			parts = append(parts, strings.ToLower(rk.String())+"="+base)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func (bf rdapBaseFlag) Set(sz string) error {
+
+	if bf.pC.BaseUrls == nil {
+		bf.pC.BaseUrls = make(map[rdap.RIRKey]string)
+	}
+
+	for _, item := range strings.Split(sz, ",") {
+		szRIR, szUrl, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || (len(szUrl) == 0) {
+			return errors.Errorf("'%s' is not of the form RIR=URL", item)
+		}
+		rk, err := rdap.RegistryNameToKey(szRIR)
+		if err != nil {
+			return err
+		}
+		bf.pC.BaseUrls[rk] = strings.TrimRight(szUrl, "/")
+	}
+	return nil
 }
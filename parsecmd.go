@@ -5,8 +5,8 @@ import (
 	"io"
 	"net/netip"
 	"regexp"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/BourgeoisBear/nicsearch/rdap"
 	"github.com/pkg/errors"
@@ -36,7 +36,7 @@ type CmdAsName struct {
 }
 
 type CmdRDAP_IP struct {
-	RIR rdap.RIRKey
+	RIR rdap.RIRKey // RkMAX for bootstrap
 	IP  netip.Addr
 }
 
@@ -46,6 +46,33 @@ type CmdRDAP_Org struct {
 	NetsOnly bool
 }
 
+type CmdRDAP_AS struct {
+	ASN   uint32
+	Table bool
+}
+
+// either of IP or ASN, by HasASN
+type RdapTarget struct {
+	IP     netip.Addr
+	ASN    uint32
+	HasASN bool
+}
+
+type CmdRDAP_Contacts struct {
+	RdapTarget
+	JSON bool
+}
+
+type CmdRDAP_Abuse struct {
+	RdapTarget
+	JSON bool
+}
+
+type CmdStatus struct {
+	Statuses StatusSet
+	CC       string
+}
+
 type CmdAll struct{}
 
 var g_cmdRegex []*regexp.Regexp
@@ -53,15 +80,23 @@ var g_cmdRegex []*regexp.Regexp
 func init() {
 
 	szRegex := []string{
-		`(AS)N?\s+(\d+)\s*(\s\+)?`,
+		`(AS)N?\s+((?:AS)?[\d.]+)\s*(\s\+)?`,
 		`(IP)\s+(.*?)\s*(\s\+)?`,
 		`(NA)(?:ME)?\s+(.*?)\s*(\s\+)?`,
 		`(CC)\s+([A-Z]{2})\s*`,
+		`(ST)(?:ATUS)?\s+([A-Z,]+)(?:\s+([A-Z]{2}))?\s*`,
 		`(ALL)\s*`,
 		`(RDAP\.EMAIL)\s+(.*?)\s*`,
-		`(RDAP\.IP)\s+(.*?)\s+(.*?)\s*`,
+		`(RDAP\.IP)\s+(?:([A-Z]+)\s+)?(\S+)\s*`,
+		`(RDAP\.AS(?:INFO)?)\s+((?:AS)?[\d.]+)\s*`,
+		`(RDAP\.(?:CONTACTS|ABUSE))\s+(\S+)(?:\s+(JSON))?\s*`,
+		`(RDAP\.PURGE)(?:\s+(EXPIRED))?\s*`,
 		`(RDAP\.ORG)\s+(.*?)\s+(.*?)\s*`,
 		`(RDAP\.ORGNETS)\s+(.*?)\s+(.*?)\s*`,
+		`(NET)\s+(.*?)\s*(\s\+)?`,
+		`(GAPS|BOGONS)(?:\s+(\S+))?\s*`,
+		`(DIFF)\s+(\S+)(?:\s+(\S+))?\s*`,
+		`(WATCH)\s+(ADD|RM|LS|CHECK)(?:\s+(.*?))?\s*`,
 	}
 
 	for _, txt := range szRegex {
@@ -76,6 +111,15 @@ type Modes struct {
 	Color        bool
 	Pretty       bool
 	PrependQuery bool
+	AsDot        bool
+	DbPath       string
+	Statuses     StatusSet
+	WatchCmd     string
+	WatchURL     string
+	RdapTTL      time.Duration
+	Offline      bool
+	Rdap         *rdap.Client
+	AsOf         time.Time // day of the -asof snapshot queried, zero for current data
 }
 
 func (m *Modes) PrintJSON(iWri io.Writer, bsJSON []byte) error {
@@ -119,17 +163,17 @@ func (m *Modes) ParseCmd(cmd string) (CmdExec, error) {
 
 		// ASN
 		case "AS":
-			nASN, e2 := strconv.ParseUint(sArg[1], 10, 32)
+			nASN, e2 := ParseASN(sArg[1])
 			if e2 != nil {
-				return nil, errors.WithMessage(e2, "invalid ASN")
+				return nil, e2
 			}
-			return CmdASN{ASN: uint32(nASN), Assoc: bGetAssociated}, nil
+			return CmdASN{ASN: nASN, Assoc: bGetAssociated}, nil
 
 		// IP
 		case "IP":
-			ip, e2 := netip.ParseAddr(sArg[1])
+			ip, e2 := ParseAddrLoose(sArg[1])
 			if e2 != nil {
-				return nil, errors.WithMessage(e2, "invalid IP")
+				return nil, e2
 			}
 			return CmdIP{IP: ip, Assoc: bGetAssociated}, nil
 
@@ -144,32 +188,64 @@ func (m *Modes) ParseCmd(cmd string) (CmdExec, error) {
 		case "CC":
 			return CmdCC{CC: sArg[1]}, nil
 
+		// STATUS
+		case "ST":
+			ss, e2 := ParseStatusSet(sArg[1])
+			if e2 != nil {
+				return nil, e2
+			}
+			return CmdStatus{Statuses: ss, CC: sArg[2]}, nil
+
 		// ALL
 		case "ALL":
 			return CmdAll{}, nil
 
 		// EMAIL
 		case "RDAP.EMAIL":
-			ip, e2 := netip.ParseAddr(sArg[1])
+			ip, e2 := ParseAddrLoose(sArg[1])
 			if e2 != nil {
-				return nil, errors.WithMessage(e2, "invalid IP")
+				return nil, e2
 			}
 			return CmdEmail{IP: ip}, nil
 
 		// RDAP
 		case "RDAP.IP":
 
-			rk, e2 := rdap.RegistryNameToKey(sArg[1])
+			// RIR is optional, picked by bootstrap when missing
+			rk := rdap.RkMAX
+			if len(sArg[1]) > 0 {
+				var e2 error
+				if rk, e2 = rdap.RegistryNameToKey(sArg[1]); e2 != nil {
+					return nil, e2
+				}
+			}
+
+			ip, e2 := ParseAddrLoose(sArg[2])
 			if e2 != nil {
 				return nil, e2
 			}
 
-			ip, e2 := netip.ParseAddr(sArg[2])
+			return CmdRDAP_IP{RIR: rk, IP: ip}, nil
+
+		case "RDAP.AS", "RDAP.ASINFO":
+			nASN, e2 := ParseASN(sArg[1])
 			if e2 != nil {
-				return nil, errors.WithMessage(e2, "invalid IP")
+				return nil, e2
 			}
+			return CmdRDAP_AS{ASN: nASN, Table: sArg[0] == "RDAP.ASINFO"}, nil
 
-			return CmdRDAP_IP{RIR: rk, IP: ip}, nil
+		case "RDAP.CONTACTS", "RDAP.ABUSE":
+			tgt, e2 := m.parseRdapTarget(sArg[1])
+			if e2 != nil {
+				return nil, e2
+			}
+			if sArg[0] == "RDAP.ABUSE" {
+				return CmdRDAP_Abuse{RdapTarget: tgt, JSON: len(sArg[2]) > 0}, nil
+			}
+			return CmdRDAP_Contacts{RdapTarget: tgt, JSON: len(sArg[2]) > 0}, nil
+
+		case "RDAP.PURGE":
+			return CmdRDAP_Purge{ExpiredOnly: len(sArg[1]) > 0}, nil
 
 		case "RDAP.ORG":
 
@@ -186,8 +262,101 @@ func (m *Modes) ParseCmd(cmd string) (CmdExec, error) {
 				return nil, e2
 			}
 			return CmdRDAP_Org{RIR: rk, OrgId: sArg[2], NetsOnly: true}, nil
+
+		case "NET":
+			pfx, e2 := ParsePrefixLoose(sArg[1])
+			if e2 != nil {
+				return nil, e2
+			}
+			return CmdNet{Prefix: pfx.Masked(), Assoc: bGetAssociated}, nil
+
+		case "GAPS", "BOGONS":
+			var v CmdGaps
+			if len(sArg[1]) > 0 {
+				pfx, e2 := ParsePrefixLoose(sArg[1])
+				if e2 != nil {
+					return nil, e2
+				}
+				v.Prefix = pfx
+			}
+			if sArg[0] == "BOGONS" {
+				return CmdBogons(v), nil
+			}
+			return v, nil
+
+		case "DIFF":
+			return CmdDiff{From: sArg[1], To: sArg[2]}, nil
+
+		case "WATCH":
+			switch sArg[1] {
+			case "ADD", "RM":
+				if len(sArg[2]) == 0 {
+					return nil, errors.New("watch query expected")
+				}
+				// validate now, rather than on next download
+				if _, e2 := m.ParseCmd(sArg[2]); e2 != nil {
+					return nil, errors.WithMessage(e2, "watch query")
+				}
+			}
+			return CmdWatch{Op: sArg[1], Query: sArg[2]}, nil
 		}
 	}
 
+	return m.detectCmd(cmd)
+}
+
+// bare IP address or ASN
+func (m *Modes) parseRdapTarget(tok string) (RdapTarget, error) {
+
+	iCmd, err := m.detectCmd(tok)
+	if err != nil {
+		return RdapTarget{}, err
+	}
+	switch V := iCmd.(type) {
+	case CmdIP:
+		return RdapTarget{IP: V.IP}, nil
+	case CmdASN:
+		return RdapTarget{ASN: V.ASN, HasASN: true}, nil
+	}
+	return RdapTarget{}, errors.New("IP address or ASN expected")
+}
+
+var (
+	g_rxBareASN = regexp.MustCompile(`^(?:AS)?[0-9.]+$`)
+	g_rxBareCC  = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// whois-style fallback, picks a query by the form of a bare token
+func (m *Modes) detectCmd(cmd string) (CmdExec, error) {
+
+	tok := strings.TrimSpace(cmd)
+	bAssoc := strings.HasSuffix(tok, "+")
+	tok = strings.TrimSpace(strings.TrimSuffix(tok, "+"))
+
+	if (len(tok) == 0) || strings.ContainsAny(tok, " \t") {
+		return nil, EInvalidQuery
+	}
+
+	switch {
+
+	case strings.Contains(tok, "/"):
+		if pfx, err := ParsePrefixLoose(tok); err == nil {
+			return CmdNet{Prefix: pfx.Masked(), Assoc: bAssoc}, nil
+		}
+
+	// NOTE: bare integers are ASNs, not decimal IPv4 addresses
+	case g_rxBareASN.MatchString(tok) && (strings.Count(tok, ".") <= 1):
+		if nASN, err := ParseASN(tok); err == nil {
+			return CmdASN{ASN: nASN, Assoc: bAssoc}, nil
+		}
+
+	case g_rxBareCC.MatchString(tok):
+		return CmdCC{CC: tok}, nil
+	}
+
+	if ip, err := ParseAddrLoose(tok); err == nil {
+		return CmdIP{IP: ip, Assoc: bAssoc}, nil
+	}
+
 	return nil, EInvalidQuery
 }
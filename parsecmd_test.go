@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestDetectCmd(t *testing.T) {
+
+	ip := netip.MustParseAddr
+	pfx := netip.MustParsePrefix
+
+	tests := []struct {
+		tok  string
+		want CmdExec // nil for EInvalidQuery
+	}{
+		// /-prefixed: nets, masked
+		{"10.1.2.3/8", CmdNet{Prefix: pfx("10.0.0.0/8")}},
+		{"2001:DB8::/32+", CmdNet{Prefix: pfx("2001:db8::/32"), Assoc: true}},
+
+		// bare integers are ASNs, not decimal IPv4
+		{"16909060", CmdASN{ASN: 16909060}},
+		{"AS15169", CmdASN{ASN: 15169}},
+		{"15169+", CmdASN{ASN: 15169, Assoc: true}},
+
+		// asdot
+		{"1.10", CmdASN{ASN: 65546}},
+		{"AS65535.65535", CmdASN{ASN: 0xFFFFFFFF}},
+
+		// two letters: country codes
+		{"DE", CmdCC{CC: "DE"}},
+
+		// anything else the loose address parser takes
+		{"192.0.2.1", CmdIP{IP: ip("192.0.2.1")}},
+		{"192[.]0[.]2[.]1+", CmdIP{IP: ip("192.0.2.1"), Assoc: true}},
+		{"[2001:DB8::1]:443", CmdIP{IP: ip("2001:db8::1")}},
+		{"0XC0000201", CmdIP{IP: ip("192.0.2.1")}},
+
+		{"", nil},
+		{"AS 15169", nil},
+		{"DEU", nil},
+		{"10.0.0.0/33", nil},
+		{"99999999999", nil},
+	}
+
+	m := &Modes{}
+	for _, tc := range tests {
+
+		got, err := m.detectCmd(tc.tok)
+		if tc.want == nil {
+			if err != EInvalidQuery {
+				t.Errorf("%q: got %#v, %v; want EInvalidQuery", tc.tok, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.tok, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %#v, want %#v", tc.tok, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package rdap
+
+import (
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// fields common to IP network & autnum replies, for walking up to parents
+type Object struct {
+	ObjectClassName string
+	Handle          string
+	ParentHandle    string
+	StartAddress    string
+	EndAddress      string
+	Entities        []Entity
+	Remarks         []Remark
+	Links           []Link
+}
+
+// how an abuse contact was found
+const (
+	AbuseByRole     = "role"     // entity with role 'abuse'
+	AbuseByRemark   = "remark"   // 'abuse-mailbox' remark (RIPE/APNIC)
+	AbuseByFallback = "fallback" // other contact role, see g_abuseFallbackRoles
+)
+
+// roles tried when an object & its parents have no abuse contact
+var g_abuseFallbackRoles = []string{"technical", "administrative", "registrant"}
+
+type AbuseContact struct {
+	Email  string   `json:"email"`
+	Handle string   `json:"handle,omitempty"`
+	Name   string   `json:"name,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+	Rule   string   `json:"rule"`
+}
+
+var g_rxEmail = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)
+
+func hasRole(ent Entity, role string) bool {
+	for _, r := range ent.Roles {
+		if strings.EqualFold(r, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// first entity with role & an email address, nearest the top of the tree
+func findByRole(sEnt []Entity, role string) (Entity, string, bool) {
+
+	for _, ent := range sEnt {
+		if hasRole(ent, role) {
+			if eml := ent.VCard.First("email"); len(eml) > 0 {
+				return ent, eml, true
+			}
+		}
+	}
+	for _, ent := range sEnt {
+		if sub, eml, ok := findByRole(ent.Entities, role); ok {
+			return sub, eml, ok
+		}
+	}
+	return Entity{}, "", false
+}
+
+func newAbuseContact(ent Entity, eml, rule string) AbuseContact {
+	ret := AbuseContact{
+		Email:  eml,
+		Handle: strings.ToUpper(ent.Handle),
+		Name:   ent.VCard.First("fn"),
+		Rule:   rule,
+	}
+	for _, r := range ent.Roles {
+		ret.Roles = append(ret.Roles, strings.ToLower(r))
+	}
+	return ret
+}
+
+// email on the first remark line mentioning abuse
+func abuseFromRemarks(sRemark []Remark) (string, bool) {
+	for _, rm := range sRemark {
+		for _, line := range append([]string{rm.Title}, rm.Description...) {
+			if !strings.Contains(strings.ToLower(line), "abuse") {
+				continue
+			}
+			if eml := g_rxEmail.FindString(line); len(eml) > 0 {
+				return eml, true
+			}
+		}
+	}
+	return "", false
+}
+
+/*
+abuse contact of this object alone: an entity with role 'abuse', else an
+'abuse-mailbox' in remarks of the object or its entities.
+*/
+func (o *Object) Abuse() (AbuseContact, bool) {
+
+	if ent, eml, ok := findByRole(o.Entities, "abuse"); ok {
+		return newAbuseContact(ent, eml, AbuseByRole), true
+	}
+
+	// notices are about the server & its terms, not the object
+	if eml, ok := abuseFromRemarks(o.Remarks); ok {
+		return AbuseContact{Email: eml, Handle: strings.ToUpper(o.Handle), Rule: AbuseByRemark}, true
+	}
+
+	var ret AbuseContact
+	var ok bool
+	processEntities(o.Entities, func(ix int, ent Entity) bool {
+		if eml, bFound := abuseFromRemarks(ent.Remarks); bFound {
+			ret, ok = newAbuseContact(ent, eml, AbuseByRemark), true
+			return false
+		}
+		return true
+	})
+	return ret, ok
+}
+
+// next best contact, by role, when there is no abuse contact
+func (o *Object) Fallback() (AbuseContact, bool) {
+	for _, role := range g_abuseFallbackRoles {
+		if ent, eml, ok := findByRole(o.Entities, role); ok {
+			return newAbuseContact(ent, eml, AbuseByFallback), true
+		}
+	}
+	return AbuseContact{}, false
+}
+
+/*
+URL of the parent object: its rel=up link, else (with a ParentHandle)
+an RFC 9082 CIDR query of the network widened by one bit, answered with
+the smallest network covering it.
+*/
+func (o *Object) ParentUrl(selfUrl string) (string, bool) {
+
+	pSelf, err := url.Parse(selfUrl)
+	if err != nil {
+		return "", false
+	}
+	for _, lnk := range o.Links {
+		if !strings.EqualFold(lnk.Rel, "up") {
+			continue
+		}
+		pUp, err := pSelf.Parse(lnk.Href)
+		if (err != nil) || (pUp.String() == pSelf.String()) {
+			continue
+		}
+		return pUp.String(), true
+	}
+
+	if len(o.ParentHandle) == 0 {
+		return "", false
+	}
+	pfx, ok := rangePrefix(o.StartAddress, o.EndAddress)
+	if !ok || (pfx.Bits() == 0) {
+		return "", false
+	}
+	ixIp := strings.LastIndex(pSelf.Path, "/ip/")
+	if ixIp < 0 {
+		return "", false
+	}
+	pfxUp := netip.PrefixFrom(pfx.Addr(), pfx.Bits()-1).Masked()
+	pSelf.Path = pSelf.Path[:ixIp] + "/ip/" + pfxUp.String()
+	pSelf.RawPath = ""
+	return pSelf.String(), true
+}
+
+// smallest prefix covering first..last
+func rangePrefix(szFirst, szLast string) (netip.Prefix, bool) {
+
+	first, e1 := netip.ParseAddr(szFirst)
+	last, e2 := netip.ParseAddr(szLast)
+	if (e1 != nil) || (e2 != nil) || (first.Is4() != last.Is4()) {
+		return netip.Prefix{}, false
+	}
+
+	for bits := first.BitLen(); bits >= 0; bits-- {
+		pfx, err := first.Prefix(bits)
+		if (err == nil) && pfx.Contains(last) {
+			return pfx, true
+		}
+	}
+	return netip.Prefix{}, false
+}
@@ -0,0 +1,114 @@
+package rdap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestObjectAbuseFixtures(t *testing.T) {
+
+	tests := map[string]AbuseContact{
+		"arin":    {Email: "network-abuse@google.com", Handle: "ABUSE5250-ARIN", Name: "Abuse", Roles: []string{"abuse"}, Rule: AbuseByRole},
+		"ripencc": {Email: "abuse@ripe.net", Handle: "OPS4-RIPE", Name: "RIPE NCC Operations", Roles: []string{"abuse"}, Rule: AbuseByRole},
+		"apnic":   {Email: "helpdesk@apnic.net", Handle: "IRT-APNICRANDNET-AU", Name: "IRT-APNICRANDNET-AU", Roles: []string{"abuse"}, Rule: AbuseByRole},
+		"lacnic":  {Email: "abuse@lacnic.net", Handle: "ABL", Name: "Abuse LACNIC", Roles: []string{"abuse"}, Rule: AbuseByRole},
+		"afrinic": {Email: "abuse@afrinic.net", Handle: "AFRINIC-IRT", Name: "AFRINIC-IRT", Roles: []string{"abuse"}, Rule: AbuseByRole},
+	}
+
+	for reg, want := range tests {
+		for _, bStrict := range []bool{true, false} {
+			var obj Object
+			if err := Decode(readFixture(t, reg), &obj, bStrict); err != nil {
+				t.Fatalf("%s (strict %v): %v", reg, bStrict, err)
+			}
+			got, ok := obj.Abuse()
+			if !ok || !reflect.DeepEqual(got, want) {
+				t.Errorf("%s (strict %v): got %+v, %v, want %+v", reg, bStrict, got, ok, want)
+			}
+		}
+	}
+}
+
+func TestObjectAbuse(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		json  string
+		path  string // of the *ParseError when strict, empty when none
+		email string // found once decoded leniently, empty when none
+		rule  string
+	}{
+		{
+			name:  "abuse role",
+			json:  netWithVCard(`["vcard", [["fn", {}, "text", "Abuse"], ["email", {}, "text", "abuse@example.net"]]]`),
+			email: "abuse@example.net",
+			rule:  AbuseByRole,
+		},
+		{
+			name:  "abuse role, malformed property",
+			json:  netWithVCard(`["vcard", [["fn", {}], ["email", {}, "text", "abuse@example.net"]]]`),
+			path:  "vcardArray[1][0]",
+			email: "abuse@example.net",
+			rule:  AbuseByRole,
+		},
+		{
+			name: "abuse role, malformed vCard",
+			json: netWithVCard(`["vcard", "abuse@example.net"]`),
+			path: "vcardArray[1]",
+		},
+		{
+			name: "object remark",
+			json: `{"handle": "NET-TEST", "remarks": [{"title": "remarks", "description": ["abuse-mailbox: noc@example.net"]}],
+				"entities": [{"handle": "TECH-1", "roles": ["technical"], "vcardArray": ["vcard", [["email", {}, "text", "tech@example.net"]]]}]}`,
+			email: "noc@example.net",
+			rule:  AbuseByRemark,
+		},
+		{
+			name: "entity remark",
+			json: `{"handle": "NET-TEST",
+				"entities": [{"handle": "IRT-1", "roles": ["registrant"], "remarks": [{"description": ["Abuse reports: irt@example.net"]}]}]}`,
+			email: "irt@example.net",
+			rule:  AbuseByRemark,
+		},
+		{
+			name: "server notice",
+			json: `{"handle": "NET-TEST", "notices": [{"title": "Abuse", "description": ["Report abuse of this service to rdap-abuse@registry.example"]}],
+				"entities": [{"handle": "TECH-1", "roles": ["technical"], "vcardArray": ["vcard", [["email", {}, "text", "tech@example.net"]]]}]}`,
+		},
+		{
+			name: "entity remark, not server notice",
+			json: `{"handle": "NET-TEST", "notices": [{"title": "Abuse", "description": ["Report abuse of this service to rdap-abuse@registry.example"]}],
+				"entities": [{"handle": "IRT-1", "roles": ["registrant"], "remarks": [{"description": ["Abuse reports: irt@example.net"]}]}]}`,
+			email: "irt@example.net",
+			rule:  AbuseByRemark,
+		},
+		{
+			name: "no abuse contact",
+			json: `{"handle": "NET-TEST",
+				"entities": [{"handle": "TECH-1", "roles": ["technical"], "vcardArray": ["vcard", [["email", {}, "text", "tech@example.net"]]]}]}`,
+		},
+	}
+
+	for _, tc := range tests {
+		for _, bStrict := range []bool{true, false} {
+
+			var obj Object
+			err := Decode([]byte(tc.json), &obj, bStrict)
+			if bStrict && (len(tc.path) > 0) {
+				if pParse, ok := err.(*ParseError); !ok || (pParse.Path != tc.path) {
+					t.Errorf("%s: strict: got %v, want *ParseError at %s", tc.name, err, tc.path)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s (strict %v): %v", tc.name, bStrict, err)
+				continue
+			}
+
+			got, ok := obj.Abuse()
+			if ok != (len(tc.email) > 0) || (got.Email != tc.email) || (got.Rule != tc.rule) {
+				t.Errorf("%s (strict %v): got %+v, %v, want %s by %s", tc.name, bStrict, got, ok, tc.email, tc.rule)
+			}
+		}
+	}
+}
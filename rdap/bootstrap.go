@@ -0,0 +1,193 @@
+package rdap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+RFC 9224 bootstrap, from the IANA registries of RDAP services:
+
+	https://data.iana.org/rdap/ipv4.json
+	https://data.iana.org/rdap/ipv6.json
+	https://data.iana.org/rdap/asn.json
+*/
+const BootstrapBaseUrl = "https://data.iana.org/rdap/"
+
+// bootstrap registry file, as published by IANA
+type BootstrapFile struct {
+	Version     string
+	Publication string
+	Description string
+	Services    [][][]string
+}
+
+type bootstrapPfx struct {
+	Prefix netip.Prefix
+	Urls   []string
+}
+
+type bootstrapAsn struct {
+	First, Last uint32
+	Urls        []string
+}
+
+type Bootstrap struct {
+	sV4, sV6 []bootstrapPfx
+	sAsn     []bootstrapAsn
+}
+
+// read a bootstrap file from cacheDir, or download it when missing or
+// older than maxAge.  stale copies are used when downloads fail, and
+// always when offline.
+func (c *Client) loadBootstrapFile(
+	ctx context.Context, cacheDir, fname string, maxAge time.Duration,
+) (BootstrapFile, error) {
+
+	var ret BootstrapFile
+	fpath := filepath.Join(cacheDir, "rdap-bootstrap-"+fname)
+
+	bsJSON, errRead := os.ReadFile(fpath)
+	bFresh := false
+	if errRead == nil {
+		if fi, err := os.Stat(fpath); (err == nil) && (c.Offline || (time.Since(fi.ModTime()) < maxAge)) {
+			bFresh = true
+		}
+	}
+
+	if !bFresh {
+		base := BootstrapBaseUrl
+		if len(c.BootstrapUrl) > 0 {
+			base = strings.TrimRight(c.BootstrapUrl, "/") + "/"
+		}
+		bsNew, err := c.Get(ctx, base+fname)
+		switch {
+		case err == nil:
+			bsJSON = bsNew
+			tmp := fpath + ".tmp"
+			if err = os.WriteFile(tmp, bsJSON, 0664); err == nil {
+				os.Rename(tmp, fpath)
+			}
+		case errRead != nil:
+			return ret, fmt.Errorf("rdap bootstrap %s: %w", fname, err)
+		}
+	}
+
+	if err := json.Unmarshal(bsJSON, &ret); err != nil {
+		return ret, fmt.Errorf("rdap bootstrap %s: %w", fname, err)
+	}
+	return ret, nil
+}
+
+// IPv4, IPv6 & ASN bootstrap registries, cached in cacheDir
+func (c *Client) LoadBootstrap(ctx context.Context, cacheDir string, maxAge time.Duration) (*Bootstrap, error) {
+
+	var ret Bootstrap
+
+	for _, fname := range []string{"ipv4.json", "ipv6.json"} {
+
+		bf, err := c.loadBootstrapFile(ctx, cacheDir, fname, maxAge)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, svc := range bf.Services {
+			if len(svc) < 2 {
+				continue
+			}
+			for _, szPfx := range svc[0] {
+				pfx, err := netip.ParsePrefix(szPfx)
+				if err != nil {
+					continue
+				}
+				item := bootstrapPfx{Prefix: pfx.Masked(), Urls: svc[1]}
+				if pfx.Addr().Is4() {
+					ret.sV4 = append(ret.sV4, item)
+				} else {
+					ret.sV6 = append(ret.sV6, item)
+				}
+			}
+		}
+	}
+
+	bf, err := c.loadBootstrapFile(ctx, cacheDir, "asn.json", maxAge)
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range bf.Services {
+		if len(svc) < 2 {
+			continue
+		}
+		for _, szRange := range svc[0] {
+			szFirst, szLast, bRange := strings.Cut(szRange, "-")
+			if !bRange {
+				szLast = szFirst
+			}
+			nFirst, e1 := strconv.ParseUint(szFirst, 10, 32)
+			nLast, e2 := strconv.ParseUint(szLast, 10, 32)
+			if (e1 != nil) || (e2 != nil) {
+				continue
+			}
+			ret.sAsn = append(ret.sAsn, bootstrapAsn{
+				First: uint32(nFirst), Last: uint32(nLast), Urls: svc[1],
+			})
+		}
+	}
+
+	return &ret, nil
+}
+
+// prefer https, without trailing slash
+func pickUrl(sUrls []string) (string, bool) {
+	if len(sUrls) == 0 {
+		return "", false
+	}
+	ret := sUrls[0]
+	for _, u := range sUrls {
+		if strings.HasPrefix(strings.ToLower(u), "https:") {
+			ret = u
+			break
+		}
+	}
+	return strings.TrimRight(ret, "/"), true
+}
+
+// base URL of the RDAP service for ip, by longest prefix match
+func (pB *Bootstrap) BaseForIP(ip netip.Addr) (string, bool) {
+
+	sPfx := pB.sV4
+	if ip.Is6() && !ip.Is4In6() {
+		sPfx = pB.sV6
+	} else {
+		ip = ip.Unmap()
+	}
+
+	var pBest *bootstrapPfx
+	for ix := range sPfx {
+		p := &sPfx[ix]
+		if p.Prefix.Contains(ip) && ((pBest == nil) || (p.Prefix.Bits() > pBest.Prefix.Bits())) {
+			pBest = p
+		}
+	}
+	if pBest == nil {
+		return "", false
+	}
+	return pickUrl(pBest.Urls)
+}
+
+// base URL of the RDAP service for an ASN
+func (pB *Bootstrap) BaseForASN(nASN uint32) (string, bool) {
+	for _, r := range pB.sAsn {
+		if (nASN >= r.First) && (nASN <= r.Last) {
+			return pickUrl(r.Urls)
+		}
+	}
+	return "", false
+}
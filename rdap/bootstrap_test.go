@@ -0,0 +1,75 @@
+package rdap
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBootstrapMatch(t *testing.T) {
+
+	dir := t.TempDir()
+	for fname, body := range map[string]string{
+		"ipv4.json": `{"services": [
+			[["41.0.0.0/8"], ["https://rdap.afrinic.net/rdap/"]],
+			[["41.128.0.0/10", "192.0.2.0/24"], ["http://rdap.example.net/", "https://rdap.example.net/"]]
+		]}`,
+		"ipv6.json": `{"services": [
+			[["2001:200::/23"], ["https://rdap.apnic.net/"]],
+			[["2001:200:100::/40"], ["https://rdap.example.net"]]
+		]}`,
+		"asn.json": `{"services": [
+			[["1-1876", "36864"], ["https://rdap.arin.net/registry/"]],
+			[["1877-1901"], ["https://rdap.db.ripe.net/"]]
+		]}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, "rdap-bootstrap-"+fname), []byte(body), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pC := NewClient()
+	pC.Offline = true
+	pB, err := pC.LoadBootstrap(context.Background(), dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		ip   string
+		want string // empty when unmatched
+	}{
+		{"41.1.2.3", "https://rdap.afrinic.net/rdap"},
+		{"41.130.0.1", "https://rdap.example.net"}, // longer prefix wins
+		{"::ffff:41.130.0.1", "https://rdap.example.net"},
+		{"192.0.2.9", "https://rdap.example.net"},
+		{"198.51.100.1", ""},
+		{"2001:200:1::1", "https://rdap.apnic.net"},
+		{"2001:200:100:ff::1", "https://rdap.example.net"},
+		{"2001:db8::1", ""},
+	} {
+		got, ok := pB.BaseForIP(netip.MustParseAddr(tc.ip))
+		if (got != tc.want) || (ok != (len(tc.want) > 0)) {
+			t.Errorf("BaseForIP(%s) = %q, %v; want %q", tc.ip, got, ok, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		asn  uint32
+		want string
+	}{
+		{1, "https://rdap.arin.net/registry"},
+		{1876, "https://rdap.arin.net/registry"},
+		{1877, "https://rdap.db.ripe.net"},
+		{36864, "https://rdap.arin.net/registry"},
+		{1902, ""},
+	} {
+		got, ok := pB.BaseForASN(tc.asn)
+		if (got != tc.want) || (ok != (len(tc.want) > 0)) {
+			t.Errorf("BaseForASN(%d) = %q, %v; want %q", tc.asn, got, ok, tc.want)
+		}
+	}
+}
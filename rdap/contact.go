@@ -0,0 +1,147 @@
+package rdap
+
+import (
+	"strings"
+)
+
+// structured vCard address (RFC 6350, 6.3.1)
+type Address struct {
+	Label    string   `json:"label,omitempty"`
+	POBox    string   `json:"pobox,omitempty"`
+	Ext      string   `json:"ext,omitempty"`
+	Street   []string `json:"street,omitempty"`
+	Locality string   `json:"locality,omitempty"`
+	Region   string   `json:"region,omitempty"`
+	Code     string   `json:"code,omitempty"`
+	Country  string   `json:"country,omitempty"`
+}
+
+// one line, from label when the server sent one
+func (a Address) String() string {
+
+	if len(a.Label) > 0 {
+		sLines := strings.FieldsFunc(a.Label, func(r rune) bool { return (r == '\n') || (r == '\r') })
+		for ix := range sLines {
+			sLines[ix] = strings.TrimSpace(sLines[ix])
+		}
+		return strings.Join(sLines, ", ")
+	}
+
+	var parts []string
+	for _, sz := range append([]string{a.POBox, a.Ext}, a.Street...) {
+		if len(sz) > 0 {
+			parts = append(parts, sz)
+		}
+	}
+	for _, sz := range []string{a.Locality, a.Region, a.Code, a.Country} {
+		if len(sz) > 0 {
+			parts = append(parts, sz)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+type Phone struct {
+	Number string   `json:"number"`
+	Types  []string `json:"types,omitempty"` // e.g. work, voice, fax
+}
+
+// contact card of an entity
+type Contact struct {
+	Roles   []string  `json:"roles"`
+	Handle  string    `json:"handle"`
+	Kind    string    `json:"kind,omitempty"`
+	Name    string    `json:"fn,omitempty"`
+	Org     []string  `json:"org,omitempty"`
+	Emails  []string  `json:"email,omitempty"`
+	Phones  []Phone   `json:"tel,omitempty"`
+	Address []Address `json:"adr,omitempty"`
+}
+
+// adr component, joined when repeated
+func adrPart(iV interface{}) []string {
+	switch V := iV.(type) {
+	case string:
+		if len(V) > 0 {
+			return []string{V}
+		}
+	case []interface{}:
+		return flattenStrings(V)
+	}
+	return nil
+}
+
+func newAddress(prop VCardProperty) Address {
+
+	var ret Address
+	if sLabel := prop.Params["label"]; len(sLabel) > 0 {
+		ret.Label = sLabel[0]
+	}
+
+	// value is a single array of 7 components
+	sComp := prop.Values
+	if len(sComp) == 1 {
+		if sArr, ok := sComp[0].([]interface{}); ok {
+			sComp = sArr
+		}
+	}
+
+	pFields := []*string{&ret.POBox, &ret.Ext, nil, &ret.Locality, &ret.Region, &ret.Code, &ret.Country}
+	for ix := 0; (ix < len(sComp)) && (ix < len(pFields)); ix++ {
+		sPart := adrPart(sComp[ix])
+		if pFields[ix] == nil {
+			ret.Street = sPart
+		} else {
+			*pFields[ix] = strings.Join(sPart, ", ")
+		}
+	}
+	return ret
+}
+
+// tel values are text, or 'tel:' URIs
+func newPhone(prop VCardProperty) (Phone, bool) {
+	sNum := flattenStrings(prop.Values)
+	if len(sNum) == 0 {
+		return Phone{}, false
+	}
+	num := strings.TrimPrefix(sNum[0], "tel:")
+	var sTypes []string
+	for _, t := range prop.Params["type"] {
+		sTypes = append(sTypes, strings.ToLower(t))
+	}
+	return Phone{Number: num, Types: sTypes}, true
+}
+
+// contact cards of all (nested) entities
+func GetContactCards(sRoot []Entity) []Contact {
+
+	var ret []Contact
+	processEntities(sRoot, func(ix int, ent Entity) bool {
+
+		ct := Contact{
+			Handle: strings.ToUpper(ent.Handle),
+			Kind:   ent.VCard.First("kind"),
+			Name:   ent.VCard.First("fn"),
+			Org:    ent.VCard.All("org"),
+			Emails: ent.VCard.All("email"),
+		}
+		for _, role := range ent.Roles {
+			ct.Roles = append(ct.Roles, strings.ToLower(role))
+		}
+
+		for _, prop := range ent.VCard {
+			switch prop.Name {
+			case "adr":
+				ct.Address = append(ct.Address, newAddress(prop))
+			case "tel":
+				if ph, ok := newPhone(prop); ok {
+					ct.Phones = append(ct.Phones, ph)
+				}
+			}
+		}
+
+		ret = append(ret, ct)
+		return true
+	})
+	return ret
+}
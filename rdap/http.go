@@ -0,0 +1,331 @@
+package rdap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+RDAP client.  All queries take a context, for timeouts & cancellation.
+The zero value is not usable; see NewClient.
+*/
+type Client struct {
+	HTTP      *http.Client
+	UserAgent string
+
+	// RDAP service base URLs by RIR, overriding GetRDAPUrls()
+	BaseUrls map[RIRKey]string
+
+	// location of IANA bootstrap registries, overriding BootstrapBaseUrl
+	BootstrapUrl string
+
+	// minimum time between requests to the same RDAP server
+	RequestInterval time.Duration
+
+	// retries of throttled (429) & transiently failed (5xx) requests
+	MaxRetries int
+
+	// longest Retry-After wait honored, before giving up
+	MaxRetryWait time.Duration
+
+	// HTTP redirects & related/up links followed by Query, per request
+	MaxReferrals int
+
+	// never touch the network: requests fail with ErrOffline, and cached
+	// bootstrap files are used however old
+	Offline bool
+
+	// fail on malformed replies, rather than skipping their malformed parts
+	Strict bool
+
+	limiter *hostLimiter
+}
+
+// client with a 30s timeout, proxies from the environment
+func NewClient() *Client {
+
+	c := &Client{
+		HTTP: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+		},
+		UserAgent:       "nicsearch",
+		RequestInterval: 500 * time.Millisecond,
+		MaxRetries:      4,
+		MaxRetryWait:    2 * time.Minute,
+		MaxReferrals:    5,
+		limiter:         &hostLimiter{mNext: make(map[string]time.Time)},
+	}
+
+	c.HTTP.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > c.MaxReferrals {
+			return fmt.Errorf("stopped after %d redirects", c.MaxReferrals)
+		}
+		// each hop is a request of its own, to a host that may differ
+		return c.limiter.wait(req.Context(), req.URL.Host, c.RequestInterval)
+	}
+	return c
+}
+
+var ErrOffline = errors.New("rdap: offline mode")
+
+// client used by package-level query functions
+var DefaultClient = NewClient()
+
+// send all requests through proxy at szUrl (e.g. http://host:3128)
+func (c *Client) SetProxy(szUrl string) error {
+
+	pU, err := url.Parse(szUrl)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL '%s': %w", szUrl, err)
+	}
+
+	pT, ok := c.HTTP.Transport.(*http.Transport)
+	if !ok {
+		pT = &http.Transport{}
+		c.HTTP.Transport = pT
+	}
+	pT.Proxy = http.ProxyURL(pU)
+	return nil
+}
+
+// base URL of RIR's RDAP service
+func (c *Client) BaseUrl(key RIRKey) string {
+	if base, ok := c.BaseUrls[key]; ok {
+		return base
+	}
+	return GetRDAPUrls()[key]
+}
+
+// base URL with BaseUrls overrides applied, e.g. to one from Bootstrap
+func (c *Client) Rebase(baseUrl string) string {
+	baseUrl = strings.TrimRight(baseUrl, "/")
+	for key, szDefault := range GetRDAPUrls() {
+		if strings.EqualFold(baseUrl, szDefault) {
+			return c.BaseUrl(key)
+		}
+	}
+	return baseUrl
+}
+
+// RFC 9083 error response
+type ErrorResponse struct {
+	ErrorCode   int
+	Title       string
+	Description OnePlusString
+}
+
+// non-200 reply, with the server's error response when it sent one
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	URL        string
+	Rdap       *ErrorResponse
+}
+
+func (e *HTTPError) Error() string {
+
+	msg := fmt.Sprintf("%s: %s", e.Status, e.URL)
+	if e.Rdap == nil {
+		return msg
+	}
+
+	var parts []string
+	if len(e.Rdap.Title) > 0 {
+		parts = append(parts, e.Rdap.Title)
+	}
+	for _, desc := range e.Rdap.Description {
+		if desc = strings.TrimSpace(desc); len(desc) > 0 {
+			parts = append(parts, desc)
+		}
+	}
+	if len(parts) == 0 {
+		return msg
+	}
+	return msg + " (" + strings.Join(parts, ": ") + ")"
+}
+
+func newHTTPError(rsp *http.Response, url string) *HTTPError {
+
+	ret := &HTTPError{StatusCode: rsp.StatusCode, Status: rsp.Status, URL: url}
+
+	bs, _ := io.ReadAll(io.LimitReader(rsp.Body, 64*1024))
+	var er ErrorResponse
+	if (json.Unmarshal(bs, &er) == nil) && ((er.ErrorCode != 0) || (len(er.Title) > 0) || (len(er.Description) > 0)) {
+		ret.Rdap = &er
+	}
+	return ret
+}
+
+// worth retrying later: cancellation, timeouts, network failures, 429 & 5xx
+func IsTransient(err error) bool {
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var pNet net.Error
+	if errors.As(err, &pNet) {
+		return true
+	}
+
+	var pHTTP *HTTPError
+	if errors.As(err, &pHTTP) {
+		return (pHTTP.StatusCode == http.StatusTooManyRequests) || isTransient(pHTTP.StatusCode)
+	}
+	return false
+}
+
+func isTransient(code int) bool {
+	switch code {
+	case http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Retry-After in seconds or as an HTTP date, zero when absent
+func retryAfter(rsp *http.Response) time.Duration {
+
+	sz := strings.TrimSpace(rsp.Header.Get("Retry-After"))
+	if len(sz) == 0 {
+		return 0
+	}
+	if n, err := strconv.Atoi(sz); err == nil {
+		if n < 0 {
+			return 0
+		}
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(sz); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// per-host request spacing
+type hostLimiter struct {
+	mu    sync.Mutex
+	mNext map[string]time.Time
+}
+
+// wait for host's next request slot, spaced by interval
+func (pL *hostLimiter) wait(ctx context.Context, host string, interval time.Duration) error {
+
+	pL.mu.Lock()
+	now := time.Now()
+	tNext := pL.mNext[host]
+	if tNext.Before(now) {
+		tNext = now
+	}
+	pL.mNext[host] = tNext.Add(interval)
+	pL.mu.Unlock()
+
+	return sleepCtx(ctx, time.Until(tNext))
+}
+
+// hold back all requests to host for d
+func (pL *hostLimiter) delay(host string, d time.Duration) {
+	pL.mu.Lock()
+	defer pL.mu.Unlock()
+	if t := time.Now().Add(d); pL.mNext[host].Before(t) {
+		pL.mNext[host] = t
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	tmr := time.NewTimer(d)
+	defer tmr.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-tmr.C:
+		return nil
+	}
+}
+
+/*
+GET with per-host rate limiting.  429 replies are retried after their
+Retry-After, and transient 5xx replies with exponential backoff.
+*/
+func (c *Client) Get(ctx context.Context, szUrl string) ([]byte, error) {
+	bs, _, err := c.get(ctx, szUrl)
+	return bs, err
+}
+
+// Get, also returning the URL answered from, after any redirects
+func (c *Client) get(ctx context.Context, szUrl string) ([]byte, string, error) {
+
+	if c.Offline {
+		return nil, "", fmt.Errorf("%w: %s", ErrOffline, szUrl)
+	}
+
+	host := szUrl
+	if pU, err := url.Parse(szUrl); err == nil {
+		host = pU.Host
+	}
+
+	backoff := time.Second
+	for nTry := 0; ; nTry++ {
+
+		if err := c.limiter.wait(ctx, host, c.RequestInterval); err != nil {
+			return nil, "", err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, szUrl, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("Accept", "application/rdap+json, application/json")
+		if len(c.UserAgent) > 0 {
+			req.Header.Set("User-Agent", c.UserAgent)
+		}
+
+		rsp, err := c.HTTP.Do(req)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if rsp.StatusCode == http.StatusOK {
+			bs, err := io.ReadAll(rsp.Body)
+			rsp.Body.Close()
+			return bs, rsp.Request.URL.String(), err
+		}
+
+		errHTTP := newHTTPError(rsp, szUrl)
+		rsp.Body.Close()
+
+		bRetry := (rsp.StatusCode == http.StatusTooManyRequests) || isTransient(rsp.StatusCode)
+		if !bRetry || (nTry >= c.MaxRetries) {
+			return nil, "", errHTTP
+		}
+
+		wait := retryAfter(rsp)
+		if wait == 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		if wait > c.MaxRetryWait {
+			return nil, "", fmt.Errorf("%w: Retry-After of %s exceeds limit", errHTTP, wait.Round(time.Second))
+		}
+		c.limiter.delay(host, wait)
+	}
+}
@@ -0,0 +1,155 @@
+package rdap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// client for httptest servers: no spacing between requests
+func newTestClient() *Client {
+	pC := NewClient()
+	pC.RequestInterval = 0
+	return pC
+}
+
+func TestGetRetryAfter(t *testing.T) {
+
+	var nHits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if nHits.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"handle": "NET-TEST"}`)
+	}))
+	defer srv.Close()
+
+	pC := newTestClient()
+	tStart := time.Now()
+	bs, err := pC.Get(context.Background(), srv.URL+"/ip/192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bs), "NET-TEST") {
+		t.Errorf("body %q", bs)
+	}
+	if n := nHits.Load(); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+	if d := time.Since(tStart); d < 900*time.Millisecond {
+		t.Errorf("retried after %s, want Retry-After of 1s", d)
+	}
+}
+
+func TestGetRetryLimits(t *testing.T) {
+
+	var nHits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nHits.Add(1)
+		if strings.HasSuffix(r.URL.Path, "/long") {
+			w.Header().Set("Retry-After", "600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"errorCode": 404, "title": "Not Found"}`)
+	}))
+	defer srv.Close()
+
+	pC := newTestClient()
+
+	// Retry-After past MaxRetryWait: give up at once
+	_, err := pC.Get(context.Background(), srv.URL+"/long")
+	var pHTTP *HTTPError
+	if !errors.As(err, &pHTTP) || (pHTTP.StatusCode != http.StatusTooManyRequests) {
+		t.Fatalf("got %v, want 429 *HTTPError", err)
+	}
+	if !strings.Contains(err.Error(), "exceeds limit") {
+		t.Errorf("got %v, want Retry-After limit", err)
+	}
+	if n := nHits.Swap(0); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+
+	// 404: not retried, error response kept
+	_, err = pC.Get(context.Background(), srv.URL+"/missing")
+	if !errors.As(err, &pHTTP) || (pHTTP.Rdap == nil) || (pHTTP.Rdap.Title != "Not Found") {
+		t.Fatalf("got %v, want 404 with RDAP error", err)
+	}
+	if IsTransient(err) {
+		t.Errorf("404 is transient")
+	}
+	if n := nHits.Load(); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+}
+
+func TestGetRedirectLimited(t *testing.T) {
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/from" {
+			http.Redirect(w, r, srv.URL+"/to", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer srv.Close()
+
+	pC := newTestClient()
+	pC.RequestInterval = 300 * time.Millisecond
+
+	tStart := time.Now()
+	_, szFinal, err := pC.get(context.Background(), srv.URL+"/from")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if szFinal != srv.URL+"/to" {
+		t.Errorf("answered from %s", szFinal)
+	}
+	if d := time.Since(tStart); d < 250*time.Millisecond {
+		t.Errorf("redirect followed after %s, want RequestInterval", d)
+	}
+}
+
+type tempNetErr struct{}
+
+func (tempNetErr) Error() string   { return "temporary" }
+func (tempNetErr) Timeout() bool   { return true }
+func (tempNetErr) Temporary() bool { return true }
+
+func TestIsTransient(t *testing.T) {
+
+	var pNet net.Error = tempNetErr{}
+
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{context.Canceled, true},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), true},
+		{pNet, true},
+		{&HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{&HTTPError{StatusCode: http.StatusBadGateway}, true},
+		{&HTTPError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&HTTPError{StatusCode: http.StatusNotFound}, false},
+		{&HTTPError{StatusCode: http.StatusNotImplemented}, false},
+		{ErrOffline, false},
+		{errors.New("malformed"), false},
+	}
+
+	for _, tc := range tests {
+		if got := IsTransient(tc.err); got != tc.want {
+			t.Errorf("IsTransient(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
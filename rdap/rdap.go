@@ -1,10 +1,10 @@
 package rdap
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"net/netip"
+	"strconv"
 	"strings"
 )
 
@@ -63,34 +63,32 @@ func RegistryNameToKey(regName string) (RIRKey, error) {
 	return RkMAX, fmt.Errorf("'%s' is not a valid registry name.  Valid registry names are: AFRINIC, APNIC, ARIN, LACNIC, and RIPENCC.", regName)
 }
 
-func getUrl(url string) ([]byte, error) {
+func (c *Client) QueryByOrg(ctx context.Context, key RIRKey, orgId string) ([]byte, error) {
+	return c.Get(ctx, EntityUrl(c.BaseUrl(key), orgId))
+}
 
-	rsp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer rsp.Body.Close()
+func (c *Client) QueryByIP(ctx context.Context, key RIRKey, ip netip.Addr) ([]byte, error) {
+	return c.Get(ctx, IPUrl(c.BaseUrl(key), ip))
+}
 
-	// error non non-200
-	if rsp.StatusCode != 200 {
-		return nil, fmt.Errorf("%s: %s", rsp.Status, url)
-	}
+func QueryByOrg(key RIRKey, orgId string) ([]byte, error) {
+	return DefaultClient.QueryByOrg(context.Background(), key, orgId)
+}
 
-	// read response
-	return io.ReadAll(rsp.Body)
+func QueryByIP(key RIRKey, ip netip.Addr) ([]byte, error) {
+	return DefaultClient.QueryByIP(context.Background(), key, ip)
 }
 
-func getRIRUrl(key RIRKey, url string) ([]byte, error) {
-	mUrl := GetRDAPUrls()
-	return getUrl(mUrl[key] + url)
+func IPUrl(baseUrl string, ip netip.Addr) string {
+	return strings.TrimRight(baseUrl, "/") + "/ip/" + ip.String()
 }
 
-func QueryByOrg(key RIRKey, orgId string) ([]byte, error) {
-	return getRIRUrl(key, "/entity/"+orgId)
+func ASNUrl(baseUrl string, nASN uint32) string {
+	return strings.TrimRight(baseUrl, "/") + "/autnum/" + strconv.FormatUint(uint64(nASN), 10)
 }
 
-func QueryByIP(key RIRKey, ip netip.Addr) ([]byte, error) {
-	return getRIRUrl(key, "/ip/"+ip.String())
+func EntityUrl(baseUrl string, handle string) string {
+	return strings.TrimRight(baseUrl, "/") + "/entity/" + handle
 }
 
 type EntityEmail struct {
@@ -103,19 +101,14 @@ func GetEmailAddrs(sRoot []Entity) []EntityEmail {
 
 	processEntities(sRoot, func(ix int, ent Entity) bool {
 
-		// TODO: ISP name, address, telephone might be nice
+		// NOTE: see GetContactCards for names, addresses & phones
 		for _, vc := range ent.VCard {
 
 			if vc.Name == "email" {
 
-				for _, iV := range vc.Values {
-
-					eml := iV.(string)
-					if len(eml) > 0 {
-
-						for _, role := range ent.Roles {
-							sEml = append(sEml, EntityEmail{Handle: strings.ToUpper(ent.Handle), Role: strings.ToLower(role), Addr: eml})
-						}
+				for _, eml := range flattenStrings(vc.Values) {
+					for _, role := range ent.Roles {
+						sEml = append(sEml, EntityEmail{Handle: strings.ToUpper(ent.Handle), Role: strings.ToLower(role), Addr: eml})
 					}
 				}
 			}
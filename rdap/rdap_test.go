@@ -0,0 +1,113 @@
+package rdap
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetEmailAddrs(t *testing.T) {
+
+	// role handle addr, sub-entities before their parents
+	tests := map[string][]string{
+		"arin": {
+			"abuse ABUSE5250-ARIN network-abuse@google.com",
+			"technical ZG39-ARIN arin-contact@google.com",
+			"administrative ZG39-ARIN arin-contact@google.com",
+		},
+		"ripencc": {
+			"abuse OPS4-RIPE abuse@ripe.net",
+		},
+		"apnic": {
+			"abuse IRT-APNICRANDNET-AU helpdesk@apnic.net",
+			"abuse IRT-APNICRANDNET-AU helpdesk@apnic.net",
+			"registrant ORG-ARAD1-AP helpdesk@apnic.net",
+			"administrative AR302-AP research@apnic.net",
+			"technical AR302-AP research@apnic.net",
+		},
+		"lacnic": {
+			"abuse ABL abuse@lacnic.net",
+			"administrative GIR infraestructura@lacnic.net",
+			"technical GIR infraestructura@lacnic.net",
+		},
+		"afrinic": {
+			"abuse AFRINIC-IRT abuse@afrinic.net",
+			"registrant ORG-AFNC1-AFRINIC hostmaster@afrinic.net",
+			"administrative AIS1-AFRINIC sysadmin@afrinic.net",
+			"technical AIS1-AFRINIC sysadmin@afrinic.net",
+		},
+	}
+
+	for reg, want := range tests {
+		for _, bStrict := range []bool{true, false} {
+			var got []string
+			for _, eml := range GetEmailAddrs(decodeFixture(t, reg, bStrict).Entities) {
+				got = append(got, strings.Join([]string{eml.Role, eml.Handle, eml.Addr}, " "))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s (strict %v): got %q, want %q", reg, bStrict, got, want)
+			}
+		}
+	}
+}
+
+func TestGetContactCards(t *testing.T) {
+
+	type card struct {
+		handle, kind, name, email, phone, address string
+	}
+
+	// in processEntities order; first email, phone & address of each
+	tests := map[string][]card{
+		"arin": {
+			{"ABUSE5250-ARIN", "group", "Abuse", "network-abuse@google.com", "+1-650-253-0000 work,voice", "1600 Amphitheatre Parkway, Mountain View, CA, 94043, United States"},
+			{"ZG39-ARIN", "group", "Google LLC", "arin-contact@google.com", "+1-650-253-0000 work,voice", "1600 Amphitheatre Parkway, Mountain View, CA, 94043, United States"},
+			{"GOGL", "org", "Google LLC", "", "", "1600 Amphitheatre Parkway, Mountain View, CA, 94043, United States"},
+		},
+		"ripencc": {
+			{"BRD-RIPE", "", "", "", "", ""},
+			{"OPS4-RIPE", "group", "RIPE NCC Operations", "abuse@ripe.net", "+31 20 535 4444 voice", "P.O. Box 10096, 1001EB, Amsterdam, NETHERLANDS"},
+			{"RIPE-NCC-MNT", "", "", "", "", ""},
+		},
+		"apnic": {
+			{"IRT-APNICRANDNET-AU", "group", "IRT-APNICRANDNET-AU", "helpdesk@apnic.net", "", "PO Box 3646, South Brisbane, QLD 4101, Australia"},
+			{"ORG-ARAD1-AP", "org", "APNIC Research and Development", "helpdesk@apnic.net", "+61-7-38583100 voice", "6 Cordelia St"},
+			{"AR302-AP", "group", "APNIC RESEARCH", "research@apnic.net", "+61-7-3858-3188 voice", "PO Box 3646, South Brisbane, QLD 4101, Australia"},
+		},
+		"lacnic": {
+			{"ABL", "individual", "Abuse LACNIC", "abuse@lacnic.net", "+598 2604 2222 [4112] work", "Rambla Republica de Mexico 6125, Montevideo, --, 11400, UY"},
+			{"GIR", "individual", "Infraestructura LACNIC", "infraestructura@lacnic.net", "+598 2604 2222 [4160] work", "Rambla Republica de Mexico 6125, Montevideo, --, 11400, UY"},
+			{"UY-LACN-LACNIC", "org", "Latin American and Caribbean IP address Regional Registry", "", "", "Rambla Republica de Mexico 6125, Montevideo, 11400, UY"},
+			{"GIR", "individual", "Infraestructura LACNIC", "infraestructura@lacnic.net", "+598 2604 2222 [4160] work", "Rambla Republica de Mexico 6125, Montevideo, --, 11400, UY"},
+		},
+		"afrinic": {
+			{"AFRINIC-IRT", "group", "AFRINIC-IRT", "abuse@afrinic.net", "+230 403 51 00 voice", "11th Floor, Standard Chartered Tower, 19, Cybercity, Ebene, Mauritius"},
+			{"ORG-AFNC1-AFRINIC", "org", "African Network Information Center - (AFRINIC)", "hostmaster@afrinic.net", "+230 403 51 00 voice", "11th Floor, Standard Chartered Tower, 19, Cybercity, Ebene, Mauritius"},
+			{"AIS1-AFRINIC", "group", "AFRINIC Infrastructure Services", "sysadmin@afrinic.net", "", ""},
+		},
+	}
+
+	for reg, want := range tests {
+		for _, bStrict := range []bool{true, false} {
+
+			var got []card
+			for _, ct := range GetContactCards(decodeFixture(t, reg, bStrict).Entities) {
+				c := card{handle: ct.Handle, kind: ct.Kind, name: ct.Name}
+				if len(ct.Emails) > 0 {
+					c.email = ct.Emails[0]
+				}
+				if len(ct.Phones) > 0 {
+					c.phone = ct.Phones[0].Number + " " + strings.Join(ct.Phones[0].Types, ",")
+				}
+				if len(ct.Address) > 0 {
+					c.address = ct.Address[0].String()
+				}
+				got = append(got, c)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s (strict %v):\n got %+v\nwant %+v", reg, bStrict, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package rdap
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// response of a Query, with the servers that referred to it
+type Reply struct {
+	Body []byte
+	URL  string   // URL of the final answer
+	Via  []string // URLs redirected or referred from, in order
+}
+
+// answer came from somewhere other than the URL queried
+func (r *Reply) Referred() bool {
+	return len(r.Via) > 0
+}
+
+// host of the server that produced the final answer
+func (r *Reply) Server() string {
+	if pU, err := url.Parse(r.URL); err == nil {
+		return pU.Host
+	}
+	return r.URL
+}
+
+// object type of an RDAP query URL (e.g. 'ip', 'autnum'), from its path
+func queryKind(pU *url.URL) string {
+	sSeg := strings.Split(strings.Trim(pU.Path, "/"), "/")
+	for ix := len(sSeg) - 2; ix >= 0; ix-- {
+		switch sSeg[ix] {
+		case "ip", "autnum", "entity", "domain", "nameserver":
+			return sSeg[ix]
+		}
+	}
+	return ""
+}
+
+/*
+related/up link of a response to the same kind of object on another
+server, as left by RIRs for resources transferred out of their region.
+links back to the same server (e.g. parent networks) are not referrals.
+*/
+func referralUrl(bsResp []byte, szFrom string) (string, bool) {
+
+	pFrom, err := url.Parse(szFrom)
+	if err != nil {
+		return "", false
+	}
+	kind := queryKind(pFrom)
+
+	var obj struct {
+		Links []Link
+	}
+	if json.Unmarshal(bsResp, &obj) != nil {
+		return "", false
+	}
+
+	for _, lnk := range obj.Links {
+
+		rel := strings.ToLower(lnk.Rel)
+		if (rel != "related") && (rel != "up") {
+			continue
+		}
+		if (len(lnk.Type) > 0) && !strings.Contains(lnk.Type, "json") {
+			continue
+		}
+
+		pTo, err := pFrom.Parse(lnk.Href)
+		if (err != nil) || !strings.HasPrefix(pTo.Scheme, "http") {
+			continue
+		}
+		if strings.EqualFold(pTo.Host, pFrom.Host) || (queryKind(pTo) != kind) {
+			continue
+		}
+		return pTo.String(), true
+	}
+	return "", false
+}
+
+/*
+GET of an RDAP URL, following HTTP redirects and referrals to other
+servers, up to MaxReferrals.  when a referral fails, the last answer
+received is returned.
+*/
+func (c *Client) Query(ctx context.Context, szUrl string) (*Reply, error) {
+
+	bs, szFinal, err := c.get(ctx, szUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &Reply{Body: bs, URL: szFinal}
+	if szFinal != szUrl {
+		ret.Via = append(ret.Via, szUrl)
+	}
+
+	mSeen := map[string]bool{szUrl: true, szFinal: true}
+	for len(ret.Via) < c.MaxReferrals {
+
+		szNext, ok := referralUrl(ret.Body, ret.URL)
+		if !ok || mSeen[szNext] {
+			break
+		}
+		mSeen[szNext] = true
+
+		bs, szFinal, err := c.get(ctx, szNext)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			break
+		}
+		mSeen[szFinal] = true
+
+		ret.Via = append(ret.Via, ret.URL)
+		if szFinal != szNext {
+			ret.Via = append(ret.Via, szNext)
+		}
+		ret.Body, ret.URL = bs, szFinal
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,111 @@
+package rdap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// RDAP server answering every ip query with handle, & links from fnLinks
+func newLinkServer(t *testing.T, handle string, fnLinks func() string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"handle": %q, "links": [%s]}`, handle, fnLinks())
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func relLink(rel, href string) string {
+	return fmt.Sprintf(`{"rel": %q, "href": %q, "type": "application/rdap+json"}`, rel, href)
+}
+
+func TestQueryReferral(t *testing.T) {
+
+	const path = "/ip/192.0.2.1"
+	ctx := context.Background()
+
+	// transferred out of A's region, to B's
+	pB := newLinkServer(t, "NET-B", func() string { return "" })
+	pA := newLinkServer(t, "NET-A", func() string { return relLink("related", pB.URL+path) })
+
+	rpl, err := newTestClient().Query(ctx, pA.URL+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (rpl.URL != pB.URL+path) || (len(rpl.Via) != 1) || (rpl.Via[0] != pA.URL+path) {
+		t.Errorf("answered from %s via %v, want B via A", rpl.URL, rpl.Via)
+	}
+	if !rpl.Referred() {
+		t.Errorf("not referred")
+	}
+
+	// parent network on the same server: not a referral
+	var pUp *httptest.Server
+	pUp = newLinkServer(t, "NET-CHILD", func() string {
+		return relLink("up", pUp.URL+"/ip/192.0.2.0/24")
+	})
+	if rpl, err = newTestClient().Query(ctx, pUp.URL+path); err != nil {
+		t.Fatal(err)
+	}
+	if rpl.Referred() || (rpl.URL != pUp.URL+path) {
+		t.Errorf("same-host up link followed, to %s", rpl.URL)
+	}
+
+	// other kinds of object are not referrals either
+	pEnt := newLinkServer(t, "NET-ENT", func() string { return relLink("related", pB.URL+"/entity/X") })
+	if rpl, err = newTestClient().Query(ctx, pEnt.URL+path); err != nil {
+		t.Fatal(err)
+	}
+	if rpl.Referred() {
+		t.Errorf("entity link followed, to %s", rpl.URL)
+	}
+}
+
+func TestQueryReferralLoop(t *testing.T) {
+
+	const path = "/ip/192.0.2.1"
+
+	var pA, pB *httptest.Server
+	pA = newLinkServer(t, "NET-A", func() string { return relLink("related", pB.URL+path) })
+	pB = newLinkServer(t, "NET-B", func() string { return relLink("related", pA.URL+path) })
+
+	rpl, err := newTestClient().Query(context.Background(), pA.URL+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (rpl.URL != pB.URL+path) || (len(rpl.Via) != 1) {
+		t.Errorf("answered from %s via %v, want B via A", rpl.URL, rpl.Via)
+	}
+}
+
+func TestQueryMaxReferrals(t *testing.T) {
+
+	const path = "/ip/192.0.2.1"
+
+	// chain of servers, each referring to the next
+	sSrv := make([]*httptest.Server, 4)
+	for ix := len(sSrv) - 1; ix >= 0; ix-- {
+		next := ""
+		if ix+1 < len(sSrv) {
+			next = relLink("related", sSrv[ix+1].URL+path)
+		}
+		sSrv[ix] = newLinkServer(t, fmt.Sprintf("NET-%d", ix), func() string { return next })
+	}
+
+	for _, nMax := range []int{0, 1, 2, 5} {
+
+		pC := newTestClient()
+		pC.MaxReferrals = nMax
+		rpl, err := pC.Query(context.Background(), sSrv[0].URL+path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		nWant := min(nMax, len(sSrv)-1)
+		if (len(rpl.Via) != nWant) || (rpl.URL != sSrv[nWant].URL+path) {
+			t.Errorf("MaxReferrals %d: answered from %s via %v, want server %d", nMax, rpl.URL, rpl.Via, nWant)
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package rdap
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 )
 
 type VCard []VCardProperty
@@ -15,51 +18,225 @@ type VCardProperty struct {
 	Values []interface{}
 }
 
+// malformed part of an RDAP response
+type ParseError struct {
+	Path string // e.g. vcardArray[1][2]
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return "rdap: " + e.Path + ": " + e.Msg
+}
+
+/*
+json.Unmarshal of an RDAP response.  when strict, fields of unexpected JSON
+types & malformed vCards are reported as a *ParseError.  otherwise they
+are skipped: mistyped fields are left empty, and malformed vCard
+properties (or whole vCards) are dropped.
+*/
+func Decode(bsJSON []byte, pObj interface{}, bStrict bool) error {
+
+	err := json.Unmarshal(bsJSON, pObj)
+
+	// only the first error is returned, so others may follow either kind
+	var pParse *ParseError
+	var pType *json.UnmarshalTypeError
+	bParse, bType := errors.As(err, &pParse), errors.As(err, &pType)
+
+	if bStrict && bType {
+		return &ParseError{Path: pType.Field, Msg: fmt.Sprintf("%s expected, got %s", pType.Type, pType.Value)}
+	}
+	if bStrict || !(bParse || bType) {
+		return err
+	}
+
+	err = decodeLenient(bsJSON, pObj)
+	if errors.As(err, &pType) {
+		return nil
+	}
+	return err
+}
+
+// Decode, strict per c.Strict
+func (c *Client) Decode(bsJSON []byte, pObj interface{}) error {
+	return Decode(bsJSON, pObj, c.Strict)
+}
+
+// decode again, without the malformed parts of vcardArrays
+func decodeLenient(bsJSON []byte, pObj interface{}) error {
+
+	var iTree interface{}
+	if err := json.Unmarshal(bsJSON, &iTree); err != nil {
+		return err
+	}
+	bsJSON, err := json.Marshal(dropBadVCards(iTree))
+	if err != nil {
+		return err
+	}
+
+	pV := reflect.ValueOf(pObj)
+	if (pV.Kind() == reflect.Pointer) && !pV.IsNil() {
+		pV.Elem().SetZero()
+	}
+	return json.Unmarshal(bsJSON, pObj)
+}
+
+func dropBadVCards(iV interface{}) interface{} {
+
+	switch V := iV.(type) {
+	case map[string]interface{}:
+		for key, iSub := range V {
+			if !strings.EqualFold(key, "vcardArray") {
+				V[key] = dropBadVCards(iSub)
+			} else if vc, ok := lenientVCard(iSub); ok {
+				V[key] = vc
+			} else {
+				delete(V, key)
+			}
+		}
+	case []interface{}:
+		for ix := range V {
+			V[ix] = dropBadVCards(V[ix])
+		}
+	}
+	return iV
+}
+
+// well-formed properties of a vcardArray, false when none can be had
+func lenientVCard(iVc interface{}) ([]interface{}, bool) {
+
+	vc, ok := iVc.([]interface{})
+	if !ok || (len(vc) < 2) {
+		return nil, false
+	}
+	props, ok := vc[1].([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	sKeep := []interface{}{}
+	for pi := range props {
+		if _, err := newVCardProperty(props[pi], pi); err == nil {
+			sKeep = append(sKeep, props[pi])
+		}
+	}
+	return []interface{}{"vcard", sKeep}, true
+}
+
 func (pv *VCard) UnmarshalJSON(bs []byte) error {
 
-	vc := make([]interface{}, 0, 2)
-	e := json.Unmarshal(bs, &vc)
-	if e != nil {
-		return fmt.Errorf("vcardArray: %w", e)
+	if string(bytes.TrimSpace(bs)) == "null" {
+		return nil
+	}
+
+	var vc []interface{}
+	if err := json.Unmarshal(bs, &vc); err != nil {
+		return &ParseError{Path: "vcardArray", Msg: err.Error()}
 	}
 
 	if len(vc) < 2 {
-		return errors.New("vcardArray: invalid -- not enough items in array")
+		return &ParseError{Path: "vcardArray", Msg: "not enough items in array"}
 	}
 
-	if vc[0].(string) != "vcard" {
-		return errors.New("vcardArray: invalid -- missing 'vcard' header")
+	if sz, ok := vc[0].(string); !ok || (sz != "vcard") {
+		return &ParseError{Path: "vcardArray[0]", Msg: "missing 'vcard' header"}
 	}
 
-	props := vc[1].([]interface{})
-	for pi := range props {
+	props, ok := vc[1].([]interface{})
+	if !ok {
+		return &ParseError{Path: "vcardArray[1]", Msg: "property list expected"}
+	}
 
-		arProp := props[pi].([]interface{})
-		var vp VCardProperty
-
-		for i := range arProp {
-			switch i {
-			case 0:
-				vp.Name = arProp[i].(string)
-			case 1:
-				tmp := arProp[i].(map[string]interface{})
-				vp.Params = make(map[string][]string, len(tmp))
-				for tkey := range tmp {
-					switch V := tmp[tkey].(type) {
-					case []string:
-						vp.Params[tkey] = V
-					case string:
-						vp.Params[tkey] = []string{V}
-					}
-				}
-			case 2:
-				vp.Type = arProp[i].(string)
-			default:
-				vp.Values = append(vp.Values, arProp[i])
-			}
+	for pi := range props {
+		vp, err := newVCardProperty(props[pi], pi)
+		if err != nil {
+			return err
 		}
 		*pv = append(*pv, vp)
 	}
 
 	return nil
 }
+
+// [name, params, type, value...]
+func newVCardProperty(iProp interface{}, pi int) (VCardProperty, error) {
+
+	var vp VCardProperty
+	fnErr := func(ix int, msg string) error {
+		return &ParseError{Path: fmt.Sprintf("vcardArray[1][%d][%d]", pi, ix), Msg: msg}
+	}
+
+	arProp, ok := iProp.([]interface{})
+	if !ok {
+		return vp, &ParseError{Path: fmt.Sprintf("vcardArray[1][%d]", pi), Msg: "property array expected"}
+	}
+	if len(arProp) < 4 {
+		return vp, &ParseError{Path: fmt.Sprintf("vcardArray[1][%d]", pi), Msg: "name, parameters, type & value expected"}
+	}
+
+	if vp.Name, ok = arProp[0].(string); !ok {
+		return vp, fnErr(0, "property name expected")
+	}
+
+	// RFC 7095 allows no other parameter value types, but be forgiving
+	tmp, ok := arProp[1].(map[string]interface{})
+	if !ok {
+		return vp, fnErr(1, "parameter object expected")
+	}
+	vp.Params = make(map[string][]string, len(tmp))
+	for tkey := range tmp {
+		switch V := tmp[tkey].(type) {
+		case []interface{}:
+			vp.Params[tkey] = flattenStrings(V)
+		case string:
+			vp.Params[tkey] = []string{V}
+		}
+	}
+
+	if vp.Type, ok = arProp[2].(string); !ok {
+		return vp, fnErr(2, "value type expected")
+	}
+
+	vp.Values = arProp[3:]
+	return vp, nil
+}
+
+// first non-empty string value of properties called name
+func (vc VCard) First(name string) string {
+	for _, prop := range vc {
+		if prop.Name != name {
+			continue
+		}
+		if sV := flattenStrings(prop.Values); len(sV) > 0 {
+			return sV[0]
+		}
+	}
+	return ""
+}
+
+// string values of a JSON array, recursing into nested arrays
+func flattenStrings(sV []interface{}) []string {
+	var ret []string
+	for _, iV := range sV {
+		switch V := iV.(type) {
+		case string:
+			if len(V) > 0 {
+				ret = append(ret, V)
+			}
+		case []interface{}:
+			ret = append(ret, flattenStrings(V)...)
+		}
+	}
+	return ret
+}
+
+// all non-empty string values of properties called name
+func (vc VCard) All(name string) []string {
+	var ret []string
+	for _, prop := range vc {
+		if prop.Name == name {
+			ret = append(ret, flattenStrings(prop.Values)...)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,294 @@
+package rdap
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// RIR fixtures in testdata, by registry
+var g_fixtures = map[string]string{
+	"arin":    "arin-ip-8.8.8.8.json",
+	"ripencc": "ripe-ip-193.0.6.139.json",
+	"apnic":   "apnic-ip-1.1.1.1.json",
+	"lacnic":  "lacnic-ip-200.7.84.1.json",
+	"afrinic": "afrinic-ip-196.216.2.1.json",
+}
+
+func readFixture(t *testing.T, reg string) []byte {
+	bs, err := os.ReadFile(filepath.Join("testdata", g_fixtures[reg]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs
+}
+
+// fixture decoded as an IPNetwork, in strict or lenient mode
+func decodeFixture(t *testing.T, reg string, bStrict bool) IPNetwork {
+	var oNet IPNetwork
+	if err := Decode(readFixture(t, reg), &oNet, bStrict); err != nil {
+		t.Fatalf("%s (strict %v): %v", reg, bStrict, err)
+	}
+	return oNet
+}
+
+func TestDecodeFixtures(t *testing.T) {
+
+	tests := []struct {
+		reg, handle, start, end string
+		nEnt                    int
+	}{
+		{"arin", "NET-8-8-8-0-2", "8.8.8.0", "8.8.8.255", 1},
+		{"ripencc", "193.0.0.0 - 193.0.7.255", "193.0.0.0", "193.0.7.255", 3},
+		{"apnic", "1.1.1.0 - 1.1.1.255", "1.1.1.0", "1.1.1.255", 3},
+		{"lacnic", "200.7.84.0/23", "200.7.84.0", "200.7.85.255", 2},
+		{"afrinic", "196.216.2.0 - 196.216.3.255", "196.216.2.0", "196.216.3.255", 3},
+	}
+
+	for _, tc := range tests {
+
+		oStrict := decodeFixture(t, tc.reg, true)
+		oLenient := decodeFixture(t, tc.reg, false)
+		if !reflect.DeepEqual(oStrict, oLenient) {
+			t.Errorf("%s: strict & lenient decodes differ", tc.reg)
+		}
+
+		if (oStrict.Handle != tc.handle) || (oStrict.StartAddress != tc.start) || (oStrict.EndAddress != tc.end) {
+			t.Errorf("%s: got %s %s-%s", tc.reg, oStrict.Handle, oStrict.StartAddress, oStrict.EndAddress)
+		}
+		if len(oStrict.Entities) != tc.nEnt {
+			t.Errorf("%s: %d entities, want %d", tc.reg, len(oStrict.Entities), tc.nEnt)
+		}
+		if len(oStrict.Notices) == 0 {
+			t.Errorf("%s: no notices", tc.reg)
+		}
+
+		// same object through the Object view used for abuse lookups
+		var obj Object
+		if err := Decode(readFixture(t, tc.reg), &obj, true); err != nil {
+			t.Errorf("%s: %v", tc.reg, err)
+		} else if obj.Handle != tc.handle {
+			t.Errorf("%s: object handle %s", tc.reg, obj.Handle)
+		}
+	}
+}
+
+// entity vCards of an IP network, one of them replaced with vcardArray
+func netWithVCard(vcardArray string) string {
+	return `{
+		"objectClassName": "ip network", "handle": "NET-TEST", "startAddress": "192.0.2.0", "endAddress": "192.0.2.255",
+		"entities": [
+			{"handle": "GOOD-1", "roles": ["technical"], "vcardArray": ["vcard", [["fn", {}, "text", "Good"], ["email", {}, "text", "good@example.net"]]]},
+			{"handle": "TEST-1", "roles": ["abuse"], "vcardArray": ` + vcardArray + `}
+		]
+	}`
+}
+
+func TestDecodeMalformed(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		json   string
+		path   string   // of the *ParseError when strict, empty when none
+		emails []string // found once decoded leniently
+	}{
+		{
+			name:   "well-formed",
+			json:   netWithVCard(`["vcard", [["fn", {}, "text", "Abuse"], ["email", {}, "text", "abuse@example.net"]]]`),
+			emails: []string{"good@example.net", "abuse@example.net"},
+		},
+		{
+			name:   "null vCard",
+			json:   netWithVCard(`null`),
+			emails: []string{"good@example.net"},
+		},
+		{
+			name:   "property without value",
+			json:   netWithVCard(`["vcard", [["fn", {}, "text"], ["email", {}, "text", "abuse@example.net"]]]`),
+			path:   "vcardArray[1][0]",
+			emails: []string{"good@example.net", "abuse@example.net"},
+		},
+		{
+			name:   "parameters as array",
+			json:   netWithVCard(`["vcard", [["fn", {}, "text", "Abuse"], ["tel", [], "text", "+1"], ["email", {}, "text", "abuse@example.net"]]]`),
+			path:   "vcardArray[1][1][1]",
+			emails: []string{"good@example.net", "abuse@example.net"},
+		},
+		{
+			name:   "property name not a string",
+			json:   netWithVCard(`["vcard", [[7, {}, "text", "x"], ["email", {}, "text", "abuse@example.net"]]]`),
+			path:   "vcardArray[1][0][0]",
+			emails: []string{"good@example.net", "abuse@example.net"},
+		},
+		{
+			name:   "property not an array",
+			json:   netWithVCard(`["vcard", ["email", ["email", {}, "text", "abuse@example.net"]]]`),
+			path:   "vcardArray[1][0]",
+			emails: []string{"good@example.net", "abuse@example.net"},
+		},
+		{
+			name:   "missing header",
+			json:   netWithVCard(`["vCard", [["email", {}, "text", "abuse@example.net"]]]`),
+			path:   "vcardArray[0]",
+			emails: []string{"good@example.net", "abuse@example.net"},
+		},
+		{
+			name:   "property list not an array",
+			json:   netWithVCard(`["vcard", {"email": "abuse@example.net"}]`),
+			path:   "vcardArray[1]",
+			emails: []string{"good@example.net"},
+		},
+		{
+			name:   "too short",
+			json:   netWithVCard(`["vcard"]`),
+			path:   "vcardArray",
+			emails: []string{"good@example.net"},
+		},
+		{
+			name:   "not an array",
+			json:   netWithVCard(`"abuse@example.net"`),
+			path:   "vcardArray",
+			emails: []string{"good@example.net"},
+		},
+		{
+			name: "mistyped field",
+			json: `{"handle": "NET-TEST", "startAddress": 3221225984, "endAddress": "192.0.2.255",
+				"entities": [{"handle": "TEST-1", "roles": ["abuse"], "vcardArray": ["vcard", [["email", {}, "text", "abuse@example.net"]]]}]}`,
+			path:   "startAddress",
+			emails: []string{"abuse@example.net"},
+		},
+		{
+			name: "mistyped field before malformed vCard",
+			json: `{"handle": 7, "startAddress": "192.0.2.0",
+				"entities": [{"handle": "TEST-1", "roles": ["abuse"], "vcardArray": ["vcard", [["fn", {}], ["email", {}, "text", "abuse@example.net"]]]}]}`,
+			path:   "handle",
+			emails: []string{"abuse@example.net"},
+		},
+	}
+
+	for _, tc := range tests {
+
+		var oStrict IPNetwork
+		err := Decode([]byte(tc.json), &oStrict, true)
+		var pParse *ParseError
+		if len(tc.path) == 0 {
+			if err != nil {
+				t.Errorf("%s: strict: %v", tc.name, err)
+			}
+		} else if !errors.As(err, &pParse) {
+			t.Errorf("%s: strict: got %v, want *ParseError", tc.name, err)
+		} else if pParse.Path != tc.path {
+			t.Errorf("%s: strict: path %s, want %s", tc.name, pParse.Path, tc.path)
+		}
+
+		var oLenient IPNetwork
+		if err = Decode([]byte(tc.json), &oLenient, false); err != nil {
+			t.Errorf("%s: lenient: %v", tc.name, err)
+			continue
+		}
+		if (oLenient.Handle != "NET-TEST") && (oLenient.StartAddress != "192.0.2.0") {
+			t.Errorf("%s: lenient: lost well-formed fields", tc.name)
+		}
+
+		var sGot []string
+		for _, eml := range GetEmailAddrs(oLenient.Entities) {
+			sGot = append(sGot, eml.Addr)
+		}
+		if !reflect.DeepEqual(sGot, tc.emails) {
+			t.Errorf("%s: lenient: emails %q, want %q", tc.name, sGot, tc.emails)
+		}
+	}
+}
+
+func TestDecodeSyntaxError(t *testing.T) {
+
+	for _, bStrict := range []bool{true, false} {
+		var oNet IPNetwork
+		err := Decode([]byte(`{"handle": "NET-TEST",`), &oNet, bStrict)
+		var pSyntax *json.SyntaxError
+		if !errors.As(err, &pSyntax) {
+			t.Errorf("strict %v: got %v, want syntax error", bStrict, err)
+		}
+	}
+}
+
+func TestClientDecode(t *testing.T) {
+
+	bs := []byte(netWithVCard(`["vcard", [["fn", {}, "text"]]]`))
+
+	var oNet IPNetwork
+	pC := NewClient()
+	if err := pC.Decode(bs, &oNet); err != nil {
+		t.Errorf("default client: %v, want lenient decode", err)
+	}
+
+	pC.Strict = true
+	var pParse *ParseError
+	if err := pC.Decode(bs, &oNet); !errors.As(err, &pParse) {
+		t.Errorf("strict client: got %v, want *ParseError", err)
+	}
+}
+
+func TestVCardUnmarshalJSON(t *testing.T) {
+
+	tests := []struct {
+		json  string
+		path  string // of the *ParseError, empty when none
+		names []string
+	}{
+		{`["vcard", []]`, "", nil},
+		{`null`, "", nil},
+		{`["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Abuse"]]]`, "", []string{"version", "fn"}},
+		{`["vcard", [["adr", {"label": "1 Main St\nTown"}, "text", null]]]`, "", []string{"adr"}},
+		{`["vcard", [["tel", {"type": ["work", "voice"]}, "text", "+1"], ["tel", {"type": "fax"}, "uri", "tel:+2"]]]`, "", []string{"tel", "tel"}},
+		{`["vcard", [["org", {}, "text", "A", "B"]]]`, "", []string{"org"}},
+		{`["vcard", [["fn", {}, "text"]]]`, "vcardArray[1][0]", nil},
+		{`["vcard", [["fn", {}, "text", "A"], ["email", null, "text", "a@example.net"]]]`, "vcardArray[1][1][1]", nil},
+		{`["vcard", [["fn", {}, 4, "A"]]]`, "vcardArray[1][0][2]", nil},
+		{`["vcard", "fn"]`, "vcardArray[1]", nil},
+		{`[1, []]`, "vcardArray[0]", nil},
+		{`[]`, "vcardArray", nil},
+		{`{}`, "vcardArray", nil},
+	}
+
+	for _, tc := range tests {
+
+		var vc VCard
+		err := json.Unmarshal([]byte(tc.json), &vc)
+		if len(tc.path) > 0 {
+			var pParse *ParseError
+			if !errors.As(err, &pParse) || (pParse.Path != tc.path) {
+				t.Errorf("%s: got %v, want *ParseError at %s", tc.json, err, tc.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.json, err)
+			continue
+		}
+
+		var sNames []string
+		for _, prop := range vc {
+			sNames = append(sNames, prop.Name)
+		}
+		if !reflect.DeepEqual(sNames, tc.names) {
+			t.Errorf("%s: properties %q, want %q", tc.json, sNames, tc.names)
+		}
+	}
+
+	// lenient decodes keep the well-formed properties only
+	var ent Entity
+	bs := []byte(`{"handle": "X", "vcardArray": ["vcard", [["fn", {}, "text", "A"], ["email", null, "text", "a@example.net"], ["email", {}, "text", "b@example.net"]]]}`)
+	if err := Decode(bs, &ent, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := ent.VCard.All("email"); !reflect.DeepEqual(got, []string{"b@example.net"}) {
+		t.Errorf("lenient: emails %q", got)
+	}
+	if got := ent.VCard.First("fn"); got != "A" {
+		t.Errorf("lenient: fn %q", got)
+	}
+}
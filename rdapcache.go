@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BourgeoisBear/nicsearch/rdap"
+	"go.etcd.io/bbolt"
+)
+
+/*
+RDAP responses, cached in a bolt file of their own, so reindexing
+leaves them alone.
+
+	obj:        map[url][unix time (8) + response]
+	net4, net6: map[first addr + last addr][url]
+
+responses are keyed by the URL queried.  IP network responses of leaf
+networks (see isLeafNetwork) are also indexed by their address range, so
+queries for other addresses inside of them are answered from cache.
+other networks may hold more-specific ones, so are never reused for
+addresses other than the one queried.
+*/
+type RdapCache struct {
+	db  *bbolt.DB
+	TTL time.Duration
+}
+
+var (
+	g_bktRdapObj  = []byte("obj")
+	g_bktRdapNet4 = []byte("net4")
+	g_bktRdapNet6 = []byte("net6")
+	g_bktRdapMeta = []byte("meta")
+)
+
+// bumped when range entries of older versions cannot be trusted
+const RdapCacheVersion = "2"
+
+// range index entries walked back from an address, before giving up
+const RdapCacheMaxSteps = 1024
+
+func OpenRdapCache(fname string, ttl time.Duration) (*RdapCache, error) {
+
+	db, err := bbolt.Open(fname, 0664, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("rdap cache %s: %w", fname, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+
+		// drop range entries of older versions, which covered any network
+		bktMeta, err := tx.CreateBucketIfNotExists(g_bktRdapMeta)
+		if err != nil {
+			return err
+		}
+		if string(bktMeta.Get([]byte("version"))) != RdapCacheVersion {
+			for _, key := range [][]byte{g_bktRdapNet4, g_bktRdapNet6} {
+				if tx.Bucket(key) != nil {
+					if err = tx.DeleteBucket(key); err != nil {
+						return err
+					}
+				}
+			}
+			if err = bktMeta.Put([]byte("version"), []byte(RdapCacheVersion)); err != nil {
+				return err
+			}
+		}
+
+		for _, key := range [][]byte{g_bktRdapObj, g_bktRdapNet4, g_bktRdapNet6} {
+			if _, err := tx.CreateBucketIfNotExists(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &RdapCache{db: db, TTL: ttl}, nil
+}
+
+func (pC *RdapCache) Close() error {
+	return pC.db.Close()
+}
+
+func (pC *RdapCache) isFresh(bsVal []byte) bool {
+	if len(bsVal) < 8 {
+		return false
+	}
+	tStored := time.Unix(int64(binary.BigEndian.Uint64(bsVal[:8])), 0)
+	return time.Since(tStored) < pC.TTL
+}
+
+func getFresh(pC *RdapCache, tx *bbolt.Tx, key []byte) ([]byte, bool) {
+	bsVal := tx.Bucket(g_bktRdapObj).Get(key)
+	if !pC.isFresh(bsVal) {
+		return nil, false
+	}
+	return Clone(bsVal[8:]), true
+}
+
+// unexpired response for an URL
+func (pC *RdapCache) Get(url string) ([]byte, bool) {
+
+	var ret []byte
+	var ok bool
+	pC.db.View(func(tx *bbolt.Tx) error {
+		ret, ok = getFresh(pC, tx, []byte(url))
+		return nil
+	})
+	return ret, ok
+}
+
+func putObj(tx *bbolt.Tx, url string, bsResp []byte) error {
+	bsVal := make([]byte, 8, 8+len(bsResp))
+	binary.BigEndian.PutUint64(bsVal, uint64(time.Now().Unix()))
+	return tx.Bucket(g_bktRdapObj).Put([]byte(url), append(bsVal, bsResp...))
+}
+
+func (pC *RdapCache) Put(url string, bsResp []byte) error {
+	return pC.db.Update(func(tx *bbolt.Tx) error {
+		return putObj(tx, url, bsResp)
+	})
+}
+
+func netBucketKey(ip netip.Addr) []byte {
+	if ip.Is4() {
+		return g_bktRdapNet4
+	}
+	return g_bktRdapNet6
+}
+
+// unexpired response of the smallest cached network covering ip
+func (pC *RdapCache) GetNet(ip netip.Addr) ([]byte, bool) {
+
+	var ret []byte
+	var ok bool
+	pC.db.View(func(tx *bbolt.Tx) error {
+
+		bsIp := ip.AsSlice()
+		nLen := len(bsIp)
+
+		// first address <= ip: seek past all keys starting with ip
+		cur := tx.Bucket(netBucketKey(ip)).Cursor()
+		bsSeek := append(Clone(bsIp), bytes.Repeat([]byte{0xFF}, nLen)...)
+		k, v := cur.Seek(bsSeek)
+		if k == nil {
+			k, v = cur.Last()
+		} else if bytes.Compare(k, bsSeek) > 0 {
+			k, v = cur.Prev()
+		}
+
+		// covering networks with later starts are smaller, and so are
+		// those with earlier ends, among equal starts
+		var bsBestFirst []byte
+		for ix := 0; (k != nil) && (ix < RdapCacheMaxSteps); ix++ {
+
+			if len(k) == 2*nLen {
+
+				bsFirst, bsLast := k[:nLen], k[nLen:]
+				if (bsBestFirst != nil) && !bytes.Equal(bsFirst, bsBestFirst) {
+					break
+				}
+
+				if bytes.Compare(bsIp, bsLast) <= 0 {
+					if bsResp, bFresh := getFresh(pC, tx, v); bFresh {
+						bsBestFirst = bsFirst
+						ret, ok = bsResp, true
+					}
+				}
+			}
+			k, v = cur.Prev()
+		}
+		return nil
+	})
+	return ret, ok
+}
+
+// cache response of an IP query, indexed by its network's range
+func (pC *RdapCache) PutNet(url string, first, last netip.Addr, bsResp []byte) error {
+	return pC.db.Update(func(tx *bbolt.Tx) error {
+		if err := putObj(tx, url, bsResp); err != nil {
+			return err
+		}
+		key := append(first.AsSlice(), last.AsSlice()...)
+		return tx.Bucket(netBucketKey(first)).Put(key, []byte(url))
+	})
+}
+
+// remove all (or only expired) responses, returning number removed
+func (pC *RdapCache) Purge(bExpiredOnly bool) (int, error) {
+
+	nPurged := 0
+	err := pC.db.Update(func(tx *bbolt.Tx) error {
+
+		bktObj := tx.Bucket(g_bktRdapObj)
+
+		var sDel [][]byte
+		err := bktObj.ForEach(func(k, v []byte) error {
+			if !bExpiredOnly || !pC.isFresh(v) {
+				sDel = append(sDel, Clone(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range sDel {
+			if err = bktObj.Delete(k); err != nil {
+				return err
+			}
+		}
+		nPurged = len(sDel)
+
+		// drop range entries of removed responses
+		for _, key := range [][]byte{g_bktRdapNet4, g_bktRdapNet6} {
+
+			bktNet := tx.Bucket(key)
+			var sDelNet [][]byte
+			bktNet.ForEach(func(k, v []byte) error {
+				if bktObj.Get(v) == nil {
+					sDelNet = append(sDelNet, Clone(k))
+				}
+				return nil
+			})
+			for _, k := range sDelNet {
+				if err = bktNet.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return nPurged, err
+}
+
+var (
+	g_rdapCache    *RdapCache
+	g_rdapCacheErr error
+)
+
+// RDAP cache in DBPATH, opened on first use
+func (m *Modes) rdapCache() (*RdapCache, error) {
+
+	if (g_rdapCache == nil) && (g_rdapCacheErr == nil) {
+		g_rdapCache, g_rdapCacheErr = OpenRdapCache(
+			filepath.Join(m.DbPath, "rdapcache.db"), m.RdapTTL,
+		)
+
+		// e.g. locked by another instance: go on without cache
+		if (g_rdapCacheErr != nil) && !m.Offline {
+			m.AnsiMsg(os.Stderr, "WARNING", g_rdapCacheErr.Error(), []uint8{1, 93})
+		}
+	}
+	return g_rdapCache, g_rdapCacheErr
+}
+
+func closeRdapCache() {
+	if g_rdapCache != nil {
+		g_rdapCache.Close()
+		g_rdapCache = nil
+	}
+}
+
+func errRdapOffline(url string) error {
+	return fmt.Errorf("not in RDAP cache (offline mode): %s", url)
+}
+
+// GET of an RDAP URL, noting answers referred to other servers
+func (m *Modes) rdapQuery(ctx context.Context, url string) ([]byte, error) {
+
+	pR, err := m.Rdap.Query(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if pR.Referred() {
+		m.AnsiMsg(os.Stderr, "REFERRED", pR.URL, []uint8{1, 96})
+	}
+	return pR.Body, nil
+}
+
+// GET of an RDAP URL, through the cache
+func (m *Modes) rdapGet(ctx context.Context, url string) ([]byte, error) {
+
+	pC, err := m.rdapCache()
+	if err != nil {
+		if m.Offline {
+			return nil, err
+		}
+		return m.rdapQuery(ctx, url)
+	}
+
+	if bsResp, ok := pC.Get(url); ok {
+		return bsResp, nil
+	}
+	if m.Offline {
+		return nil, errRdapOffline(url)
+	}
+
+	bsResp, err := m.rdapQuery(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return bsResp, pC.Put(url, bsResp)
+}
+
+/*
+network types of assignments to end users, which RIRs do not subdivide
+into more-specific networks:
+
+	ARIN:            ASSIGNMENT, REASSIGNMENT
+	RIPE, AFRINIC:   ASSIGNED PI, ASSIGNED ANYCAST
+	APNIC:           ASSIGNED PORTABLE
+*/
+var g_leafNetTypes = map[string]bool{
+	"ASSIGNMENT":        true,
+	"REASSIGNMENT":      true,
+	"ASSIGNED PI":       true,
+	"ASSIGNED ANYCAST":  true,
+	"ASSIGNED PORTABLE": true,
+}
+
+// no more-specific network can exist inside of oNet
+func isLeafNetwork(oNet *rdap.IPNetwork, first, last netip.Addr) bool {
+	return (first == last) || g_leafNetTypes[strings.ToUpper(strings.TrimSpace(oNet.Type))]
+}
+
+// IP query, answered from a cached leaf network covering ip
+func (m *Modes) rdapGetIP(ctx context.Context, baseUrl string, ip netip.Addr) ([]byte, error) {
+
+	url := rdap.IPUrl(baseUrl, ip)
+
+	pC, err := m.rdapCache()
+	if err != nil {
+		if m.Offline {
+			return nil, err
+		}
+		return m.rdapQuery(ctx, url)
+	}
+
+	if bsResp, ok := pC.GetNet(ip); ok {
+		return bsResp, nil
+	}
+	if bsResp, ok := pC.Get(url); ok {
+		return bsResp, nil
+	}
+	if m.Offline {
+		return nil, errRdapOffline(url)
+	}
+
+	bsResp, err := m.rdapQuery(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	// index by network range, when the reply has one & it is a leaf
+	var oNet rdap.IPNetwork
+	if m.Rdap.Decode(bsResp, &oNet) == nil {
+		first, e1 := netip.ParseAddr(oNet.StartAddress)
+		last, e2 := netip.ParseAddr(oNet.EndAddress)
+		if (e1 == nil) && (e2 == nil) && (first.Is4() == last.Is4()) && !last.Less(first) &&
+			(first.Compare(ip) <= 0) && (ip.Compare(last) <= 0) && isLeafNetwork(&oNet, first, last) {
+			return bsResp, pC.PutNet(url, first, last, bsResp)
+		}
+	}
+	return bsResp, pC.Put(url, bsResp)
+}
+
+type CmdRDAP_Purge struct {
+	ExpiredOnly bool
+}
+
+func (v CmdRDAP_Purge) Exec(cep CmdExecParams) error {
+
+	pC, err := cep.rdapCache()
+	if err != nil {
+		return err
+	}
+	nPurged, err := pC.Purge(v.ExpiredOnly)
+	if err != nil {
+		return err
+	}
+	cep.AnsiMsg(os.Stderr, "PURGED", fmt.Sprintf("%d RDAP responses", nPurged), []uint8{1, 96})
+	return nil
+}
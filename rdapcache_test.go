@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BourgeoisBear/nicsearch/rdap"
+)
+
+// RDAP stand-in: a /9 allocation holding a /24 assignment
+func newRdapStandIn(t *testing.T, pHits *int32) *httptest.Server {
+
+	mNets := []map[string]string{
+		{"handle": "NET-GOOGLE", "type": "REASSIGNMENT", "startAddress": "8.8.4.0", "endAddress": "8.8.4.255"},
+		{"handle": "NET-L3", "type": "DIRECT ALLOCATION", "startAddress": "8.0.0.0", "endAddress": "8.127.255.255"},
+	}
+
+	pSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(pHits, 1)
+		ip, err := netip.ParseAddr(strings.TrimPrefix(r.URL.Path, "/ip/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		for _, mNet := range mNets {
+			first := netip.MustParseAddr(mNet["startAddress"])
+			last := netip.MustParseAddr(mNet["endAddress"])
+			if (first.Compare(ip) <= 0) && (ip.Compare(last) <= 0) {
+				mNet["objectClassName"] = "ip network"
+				json.NewEncoder(w).Encode(mNet)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(pSrv.Close)
+	return pSrv
+}
+
+func newCacheTestModes(t *testing.T) *Modes {
+
+	closeRdapCache()
+	g_rdapCacheErr = nil
+	t.Cleanup(func() {
+		closeRdapCache()
+		g_rdapCacheErr = nil
+	})
+
+	pC := rdap.NewClient()
+	pC.RequestInterval = 0
+	return &Modes{DbPath: t.TempDir(), RdapTTL: time.Hour, Rdap: pC}
+}
+
+func TestRdapGetIPMoreSpecific(t *testing.T) {
+
+	var nHits int32
+	pSrv := newRdapStandIn(t, &nHits)
+	m := newCacheTestModes(t)
+	ctx := context.Background()
+
+	type step struct {
+		ip      string
+		handle  string
+		bCached bool
+	}
+
+	steps := []step{
+		// allocation: cached for its own URL only
+		{"8.0.0.1", "NET-L3", false},
+		{"8.0.0.1", "NET-L3", true},
+		{"8.8.4.4", "NET-GOOGLE", false},
+		{"8.0.0.2", "NET-L3", false},
+
+		// assignment: answers other addresses inside of it
+		{"8.8.4.5", "NET-GOOGLE", true},
+		{"8.8.4.255", "NET-GOOGLE", true},
+	}
+
+	for _, st := range steps {
+
+		nBefore := atomic.LoadInt32(&nHits)
+		bsResp, err := m.rdapGetIP(ctx, pSrv.URL, netip.MustParseAddr(st.ip))
+		if err != nil {
+			t.Fatalf("%s: %v", st.ip, err)
+		}
+
+		var oNet rdap.IPNetwork
+		if err = json.Unmarshal(bsResp, &oNet); err != nil {
+			t.Fatalf("%s: %v", st.ip, err)
+		}
+		if oNet.Handle != st.handle {
+			t.Errorf("%s: got %s, want %s", st.ip, oNet.Handle, st.handle)
+		}
+		if bCached := atomic.LoadInt32(&nHits) == nBefore; bCached != st.bCached {
+			t.Errorf("%s: cached %v, want %v", st.ip, bCached, st.bCached)
+		}
+	}
+}
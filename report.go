@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+// log timestamps: ISO 8601, common log format & syslog
+var g_rxTimestamp = regexp.MustCompile(
+	`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?` +
+		`|\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}` +
+		`|[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`,
+)
+
+// evidence line, and the timestamp found in it (if any)
+type ReportEvent struct {
+	Time string
+	Line string
+}
+
+type ReportIP struct {
+	IP     netip.Addr
+	Events []ReportEvent
+}
+
+// first & last timestamps of the address's evidence, as logged
+func (pI *ReportIP) FirstSeen() string {
+	for _, ev := range pI.Events {
+		if len(ev.Time) > 0 {
+			return ev.Time
+		}
+	}
+	return ""
+}
+
+func (pI *ReportIP) LastSeen() string {
+	for ix := len(pI.Events) - 1; ix >= 0; ix-- {
+		if len(pI.Events[ix].Time) > 0 {
+			return pI.Events[ix].Time
+		}
+	}
+	return ""
+}
+
+// template data: addresses reported to one abuse contact
+type AbuseReport struct {
+	To        string
+	Contact   *AbuseResult
+	Networks  []string // handles of the networks holding IPs
+	IPs       []*ReportIP
+	Generated time.Time
+}
+
+/*
+groups addresses of log lines by abuse contact.  RDAP lookups are made
+once per leaf network: addresses inside of one already looked up are
+assigned to its contact.  other networks may hold more-specific ones
+with their own contacts, so each address in them is looked up.
+*/
+type AbuseReporter struct {
+	*Modes
+	Db *bbolt.DB
+
+	mIP      map[netip.Addr]*ReportIP
+	nSkipped int
+}
+
+func NewAbuseReporter(m *Modes, db *bbolt.DB) *AbuseReporter {
+	return &AbuseReporter{Modes: m, Db: db, mIP: make(map[netip.Addr]*ReportIP)}
+}
+
+// first address of each line is the one reported, the line its evidence
+func (pR *AbuseReporter) Read(iRd io.Reader) error {
+
+	sc := bufio.NewScanner(iRd)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+
+		line := strings.TrimSpace(sc.Text())
+		if (len(line) == 0) || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sAddr := FindTextAddrs(line)
+		if len(sAddr) == 0 {
+			pR.nSkipped++
+			continue
+		}
+
+		ip := sAddr[0].IP.Unmap()
+		pI, ok := pR.mIP[ip]
+		if !ok {
+			pI = &ReportIP{IP: ip}
+			pR.mIP[ip] = pI
+		}
+		pI.Events = append(pI.Events, ReportEvent{
+			Time: g_rxTimestamp.FindString(line),
+			Line: line,
+		})
+	}
+	return sc.Err()
+}
+
+// reports by abuse contact, sorted by address; failed lookups are printed
+func (pR *AbuseReporter) Group(ctx context.Context) ([]*AbuseReport, int, error) {
+
+	sIP := make([]*ReportIP, 0, len(pR.mIP))
+	for _, pI := range pR.mIP {
+		sIP = append(sIP, pI)
+	}
+	sort.Slice(sIP, func(i, j int) bool { return sIP[i].IP.Less(sIP[j].IP) })
+
+	var sNet []*AbuseResult
+	mReport := make(map[string]*AbuseReport)
+	nUnreported := 0
+
+	for _, pI := range sIP {
+
+		var pRes *AbuseResult
+		for _, pN := range sNet {
+			if pN.Covers(pI.IP) {
+				pRes = pN
+				break
+			}
+		}
+
+		if pRes == nil {
+			var err error
+			pRes, err = pR.FindAbuse(ctx, pR.Db, RdapTarget{IP: pI.IP})
+			if ctx.Err() != nil {
+				return nil, 0, ctx.Err()
+			}
+			if pRes != nil {
+				sNet = append(sNet, pRes)
+			}
+			if err != nil {
+				pR.printErr(err, pI.IP.String())
+				nUnreported++
+				continue
+			}
+		}
+
+		// network without an abuse contact, from an earlier lookup
+		if len(pRes.Email) == 0 {
+			nUnreported++
+			continue
+		}
+
+		key := strings.ToLower(pRes.Email)
+		pRpt, ok := mReport[key]
+		if !ok {
+			pRpt = &AbuseReport{To: pRes.Email, Contact: pRes, Generated: time.Now()}
+			mReport[key] = pRpt
+		}
+		if !slices.Contains(pRpt.Networks, pRes.Object) {
+			pRpt.Networks = append(pRpt.Networks, pRes.Object)
+		}
+		pRpt.IPs = append(pRpt.IPs, pI)
+	}
+
+	sRpt := make([]*AbuseReport, 0, len(mReport))
+	for _, pRpt := range mReport {
+		sRpt = append(sRpt, pRpt)
+	}
+	sort.Slice(sRpt, func(i, j int) bool { return strings.ToLower(sRpt[i].To) < strings.ToLower(sRpt[j].To) })
+	return sRpt, nUnreported, nil
+}
+
+// report file name for an email address
+func reportFname(email string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case (r >= 'a') && (r <= 'z'), (r >= 'A') && (r <= 'Z'), (r >= '0') && (r <= '9'), strings.ContainsRune("@._-+", r):
+			return r
+		}
+		return '_'
+	}, email) + ".txt"
+}
+
+var g_reportFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+func (m *Modes) AbuseReports(db *bbolt.DB, sArgs []string) error {
+
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	szIn := fs.String("in", "-", "input `FILE` ('-' for stdin), of log lines holding IP addresses")
+	szTmpl := fs.String("tmpl", "", "text/template `FILE` rendered once per abuse contact")
+	szOut := fs.String("out", "", "write one report per contact into `DIR`, rather than to stdout")
+	if err := fs.Parse(sArgs); err != nil {
+		return err
+	}
+	if len(*szTmpl) == 0 {
+		return errors.New("report: -tmpl FILE required")
+	}
+
+	pTmpl, err := template.New(filepath.Base(*szTmpl)).Funcs(g_reportFuncs).ParseFiles(*szTmpl)
+	if err != nil {
+		return err
+	}
+
+	var iRd io.Reader = os.Stdin
+	if *szIn != "-" {
+		pF, err := os.Open(*szIn)
+		if err != nil {
+			return err
+		}
+		defer pF.Close()
+		iRd = pF
+	}
+
+	pR := NewAbuseReporter(m, db)
+	if err = pR.Read(iRd); err != nil {
+		return err
+	}
+
+	// Ctrl-C stops lookups
+	ctx, fnStop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer fnStop()
+
+	sRpt, nUnreported, err := pR.Group(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(*szOut) > 0 {
+		if err = os.MkdirAll(*szOut, 0775); err != nil {
+			return err
+		}
+	}
+
+	for _, pRpt := range sRpt {
+
+		if len(*szOut) == 0 {
+			if err = pTmpl.Execute(os.Stdout, pRpt); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fpath := filepath.Join(*szOut, reportFname(pRpt.To))
+		pF, err := os.Create(fpath)
+		if err != nil {
+			return err
+		}
+		err = pTmpl.Execute(pF, pRpt)
+		if e2 := pF.Close(); err == nil {
+			err = e2
+		}
+		if err != nil {
+			return errors.WithMessage(err, fpath)
+		}
+	}
+
+	m.AnsiMsg(
+		os.Stderr, "REPORTS",
+		fmt.Sprintf(
+			"%d contacts, %d addresses (%d without abuse contact), %d lines without address",
+			len(sRpt), len(pR.mIP), nUnreported, pR.nSkipped,
+		),
+		[]uint8{1, 96},
+	)
+	return nil
+}
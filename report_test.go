@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/BourgeoisBear/nicsearch/rdap"
+)
+
+/*
+RDAP stand-in for reports: an allocation with its own abuse desk,
+holding assignments with theirs (one shared with the allocation) & one
+with no contact at all
+*/
+func newReportStandIn(t *testing.T, pHits *int32) *httptest.Server {
+
+	type net struct {
+		handle, kind, first, last, email string
+	}
+	sNets := []net{
+		{"NET-LEAF", "REASSIGNMENT", "8.8.4.0", "8.8.4.255", "abuse@leaf.example"},
+		{"NET-LEAF2", "REASSIGNMENT", "8.9.0.0", "8.9.0.255", "abuse@big.example"},
+		{"NET-NONE", "REASSIGNMENT", "8.10.0.0", "8.10.0.255", ""},
+		{"NET-BIG", "DIRECT ALLOCATION", "8.0.0.0", "8.127.255.255", "abuse@big.example"},
+	}
+
+	pSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(pHits, 1)
+		ip, err := netip.ParseAddr(strings.TrimPrefix(r.URL.Path, "/ip/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		for _, n := range sNets {
+			if (netip.MustParseAddr(n.first).Compare(ip) > 0) || (ip.Compare(netip.MustParseAddr(n.last)) > 0) {
+				continue
+			}
+			mNet := map[string]interface{}{
+				"objectClassName": "ip network", "handle": n.handle, "type": n.kind,
+				"startAddress": n.first, "endAddress": n.last,
+			}
+			if len(n.email) > 0 {
+				mNet["entities"] = []interface{}{map[string]interface{}{
+					"objectClassName": "entity", "handle": "ABUSE-" + n.handle, "roles": []string{"abuse"},
+					"vcardArray": []interface{}{"vcard", []interface{}{
+						[]interface{}{"fn", map[string]string{}, "text", "Abuse"},
+						[]interface{}{"email", map[string]string{}, "text", n.email},
+					}},
+				}}
+			}
+			json.NewEncoder(w).Encode(mNet)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(pSrv.Close)
+	return pSrv
+}
+
+func TestAbuseReporterGroup(t *testing.T) {
+
+	var nHits int32
+	pSrv := newReportStandIn(t, &nHits)
+
+	// RDAP service picked from the local index, not from the bootstrap
+	g_bootstrap, g_bootstrapErr = nil, errors.New("no bootstrap in tests")
+	t.Cleanup(func() { g_bootstrap, g_bootstrapErr = nil, nil })
+
+	m := newCacheTestModes(t)
+	m.Statuses = DefaultStatusSet()
+	m.Rdap.BaseUrls = map[rdap.RIRKey]string{rdap.RkArin: pSrv.URL}
+	db := newTestIndex(t, []string{"arin|US|ipv4|8.0.0.0|8388608|20000101|allocated|ORG-BIG"})
+
+	// first address in the allocation, later ones in its assignments
+	sLines := []string{
+		"2024-05-01T10:00:00Z sshd: failed login from 8.1.0.1",
+		"2024-05-01T10:00:05Z sshd: failed login from 8.8.4.4",
+		"2024-05-01T10:00:09Z sshd: failed login from 8.8.4.9",
+		"2024-05-01T10:01:00Z sshd: failed login from 8.1.0.1",
+		"2024-05-01T10:02:00Z sshd: failed login from 8.9.0.7",
+		"2024-05-01T10:03:00Z sshd: failed login from 8.1.0.2",
+		"2024-05-01T10:04:00Z sshd: failed login from 8.10.0.1",
+		"2024-05-01T10:04:01Z sshd: failed login from 8.10.0.2",
+		"no address here",
+	}
+
+	pR := NewAbuseReporter(m, db)
+	if err := pR.Read(strings.NewReader(strings.Join(sLines, "\n"))); err != nil {
+		t.Fatal(err)
+	}
+	sRpt, nUnreported, err := pR.Group(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, pRpt := range sRpt {
+		var sIPs []string
+		for _, pI := range pRpt.IPs {
+			sIPs = append(sIPs, fmt.Sprintf("%s*%d", pI.IP, len(pI.Events)))
+		}
+		got = append(got, fmt.Sprintf("%s %s %s", pRpt.To, strings.Join(pRpt.Networks, ","), strings.Join(sIPs, ",")))
+	}
+	want := []string{
+		"abuse@big.example NET-BIG,NET-LEAF2 8.1.0.1*2,8.1.0.2*1,8.9.0.7*1",
+		"abuse@leaf.example NET-LEAF 8.8.4.4*1,8.8.4.9*1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+	if nUnreported != 2 {
+		t.Errorf("%d unreported, want 2", nUnreported)
+	}
+	if pR.nSkipped != 1 {
+		t.Errorf("%d lines skipped, want 1", pR.nSkipped)
+	}
+
+	// allocation addresses each looked up; assignments once each
+	if nHits != 5 {
+		t.Errorf("%d RDAP queries, want 5", nHits)
+	}
+}
+
+func TestAbuseReporterRead(t *testing.T) {
+
+	sLines := []string{
+		"# comment 192.0.2.1",
+		`192.0.2.1 - - [10/Oct/2024:13:55:36 -0700] "GET / HTTP/1.1" 200 2326`,
+		"Oct  9 08:01:02 host sshd[1]: Invalid user from 192.0.2.1 port 22",
+		"2024-10-11 04:05:06.789+02:00 blocked ::ffff:192.0.2.1",
+		"192.0.2.1 no time",
+		"2001:db8::1 at 2024-10-12T00:00:00Z then 192.0.2.9",
+		"",
+	}
+
+	pR := NewAbuseReporter(&Modes{}, nil)
+	if err := pR.Read(strings.NewReader(strings.Join(sLines, "\n"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// one entry per address (mapped addresses unmapped), first address of a line only
+	if len(pR.mIP) != 2 {
+		t.Fatalf("%d addresses, want 2: %v", len(pR.mIP), pR.mIP)
+	}
+
+	pI := pR.mIP[netip.MustParseAddr("192.0.2.1")]
+	var sTimes []string
+	for _, ev := range pI.Events {
+		sTimes = append(sTimes, ev.Time)
+	}
+	wantTimes := []string{"10/Oct/2024:13:55:36 -0700", "Oct  9 08:01:02", "2024-10-11 04:05:06.789+02:00", ""}
+	if !reflect.DeepEqual(sTimes, wantTimes) {
+		t.Errorf("times %q, want %q", sTimes, wantTimes)
+	}
+	if (pI.FirstSeen() != wantTimes[0]) || (pI.LastSeen() != wantTimes[2]) {
+		t.Errorf("first %q, last %q", pI.FirstSeen(), pI.LastSeen())
+	}
+
+	pI = pR.mIP[netip.MustParseAddr("2001:db8::1")]
+	if (pI == nil) || (pI.FirstSeen() != "2024-10-12T00:00:00Z") {
+		t.Errorf("2001:db8::1: %+v", pI)
+	}
+}
+
+func TestReportFname(t *testing.T) {
+
+	tests := map[string]string{
+		"abuse@example.net":    "abuse@example.net.txt",
+		"Abuse+ip@Example.NET": "Abuse+ip@Example.NET.txt",
+		"a/b c@x.example":      "a_b_c@x.example.txt",
+		"../../etc/passwd":     ".._.._etc_passwd.txt",
+		"ünï@example.net":      "_n_@example.net.txt",
+	}
+	for in, want := range tests {
+		if got := reportFname(in); got != want {
+			t.Errorf("%q: got %q, want %q", in, got, want)
+		}
+	}
+}
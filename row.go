@@ -46,6 +46,32 @@ func (pR *Row) IsType(s ...TypeKey) bool {
 	return false
 }
 
+func (pR *Row) HasIP(ip netip.Addr) bool {
+	for ix := range pR.IpRange {
+		if pR.IpRange[ix].Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// raw delegation fields, re-joined in RIR stats exchange format
+func (pR *Row) Line() string {
+	return string(bytes.Join(
+		[][]byte{
+			pR.Registry,
+			pR.Cc,
+			pR.Type,
+			pR.Start,
+			pR.Value,
+			pR.Date,
+			pR.Status,
+			pR.RegId,
+		},
+		[]byte("|"),
+	))
+}
+
 func SortRows(rows []Row) map[TypeKey][]*Row {
 
 	keys := []TypeKey{TkIP4, TkIP6, TkASN}
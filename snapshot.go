@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const snapshotDayFmt = "20060102"
+
+func SnapshotRoot(dbPath string) string {
+	return filepath.Join(dbPath, "snapshots")
+}
+
+func SnapshotDayDir(dbPath string, day time.Time) string {
+	return filepath.Join(SnapshotRoot(dbPath), day.Format(snapshotDayFmt))
+}
+
+// copy freshly downloaded delegation file into today's snapshot directory
+func SaveSnapshot(dbPath, fname string, day time.Time) error {
+
+	dir := SnapshotDayDir(dbPath, day)
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return err
+	}
+
+	dst := filepath.Join(dir, filepath.Base(fname))
+	os.Remove(dst)
+	os.Remove(filepath.Join(dir, "nicsearch.db"))
+
+	// prefer hardlink, fallback to copy
+	if os.Link(fname, dst) == nil {
+		return nil
+	}
+
+	pSrc, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer pSrc.Close()
+
+	pDst, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(pDst, pSrc); err != nil {
+		pDst.Close()
+		os.Remove(dst)
+		return err
+	}
+	return pDst.Close()
+}
+
+// list snapshot days, oldest first
+func ListSnapshots(dbPath string) ([]time.Time, error) {
+
+	sEnt, err := os.ReadDir(SnapshotRoot(dbPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	ret := make([]time.Time, 0, len(sEnt))
+	for _, ent := range sEnt {
+		if !ent.IsDir() {
+			continue
+		}
+		day, err := time.Parse(snapshotDayFmt, ent.Name())
+		if err != nil {
+			continue
+		}
+		ret = append(ret, day)
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Before(ret[j]) })
+	return ret, nil
+}
+
+// days a complete snapshot may lie from the date asked for, to be preferred
+// over a nearer partial one
+const SnapshotMaxSkewDays = 7
+
+/*
+find snapshot day closest to asOf (earlier day wins ties).  a snapshot of
+asOf itself is always taken; otherwise snapshots holding every RIR's
+delegations are preferred, when within SnapshotMaxSkewDays of asOf.
+files missing from the day returned are listed.
+*/
+func NearestSnapshot(dbPath string, asOf time.Time) (time.Time, []string, error) {
+
+	sDays, err := ListSnapshots(dbPath)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	if len(sDays) == 0 {
+		return time.Time{}, nil, fmt.Errorf(
+			"no snapshots in %s (see -backfill)", SnapshotRoot(dbPath),
+		)
+	}
+
+	absDur := func(d time.Duration) time.Duration {
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	maxSkew := time.Duration(SnapshotMaxSkewDays) * 24 * time.Hour
+
+	var best, bestAny time.Time
+	var bestAnyMissing []string
+	for ix, day := range sDays {
+
+		sMissing, err := SnapshotMissing(dbPath, day)
+		if err != nil {
+			return time.Time{}, nil, err
+		}
+
+		dist := absDur(day.Sub(asOf))
+		if (ix == 0) || (dist < absDur(bestAny.Sub(asOf))) {
+			bestAny, bestAnyMissing = day, sMissing
+		}
+		if (len(sMissing) == 0) && (dist <= maxSkew) && (best.IsZero() || (dist < absDur(best.Sub(asOf)))) {
+			best = day
+		}
+	}
+
+	if best.IsZero() || bestAny.Equal(asOf) {
+		return bestAny, bestAnyMissing, nil
+	}
+	return best, nil, nil
+}
+
+// snapshot delegation files expected from each RIR, but absent
+func SnapshotMissing(dbPath string, day time.Time) ([]string, error) {
+
+	dir := SnapshotDayDir(dbPath, day)
+
+	var ret []string
+	for _, item := range GetRIRDownloadItems(dbPath) {
+		fname := filepath.Base(item.DstPath)
+		if _, err := os.Stat(filepath.Join(dir, fname)); err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+			ret = append(ret, fname)
+		}
+	}
+
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// NearestSnapshot, warning when it is of another day, or partial
+func (m *Modes) nearestSnapshot(asOf time.Time) (time.Time, error) {
+
+	day, sMissing, err := NearestSnapshot(m.DbPath, asOf)
+	if err != nil {
+		return day, err
+	}
+
+	szDay := day.Format("2006-01-02")
+	if nDays := int(day.Sub(asOf).Hours() / 24); nDays != 0 {
+		szWhen := "after"
+		if nDays < 0 {
+			nDays, szWhen = -nDays, "before"
+		}
+		m.AnsiMsg(
+			os.Stderr, "WARNING",
+			fmt.Sprintf(
+				"nearest snapshot is %s, %d day(s) %s %s",
+				szDay, nDays, szWhen, asOf.Format("2006-01-02"),
+			),
+			[]uint8{1, 93},
+		)
+	}
+	if len(sMissing) > 0 {
+		m.AnsiMsg(
+			os.Stderr, "WARNING",
+			fmt.Sprintf("snapshot %s lacks %s", szDay, strings.Join(sMissing, ", ")),
+			[]uint8{1, 93},
+		)
+	}
+	return day, nil
+}
+
+// delegation files present in a snapshot directory
+func SnapshotFiles(dbPath string, day time.Time) ([]string, error) {
+	return filepath.Glob(
+		filepath.Join(SnapshotDayDir(dbPath, day), "delegated-*.txt.gz"),
+	)
+}
+
+// fetch archived delegation files for a given day from each RIR
+func (m *Modes) Backfill(dbPath string, day time.Time) error {
+
+	dir := SnapshotDayDir(dbPath, day)
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return err
+	}
+
+	// stale snapshot index
+	os.Remove(filepath.Join(dir, "nicsearch.db"))
+
+	nFetched := 0
+	for _, sItems := range GetRIRArchiveItems(dbPath, day) {
+
+		var err error
+		for _, item := range sItems {
+			if err = m.DownloadAll(os.Stderr, item, dir); err == nil {
+				nFetched += 1
+				break
+			}
+		}
+
+		if err != nil {
+			m.printErr(err, "")
+		}
+	}
+
+	if nFetched == 0 {
+		os.Remove(dir)
+		return fmt.Errorf("no archives found for %s", day.Format("2006-01-02"))
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNearestSnapshot(t *testing.T) {
+
+	dbPath := t.TempDir()
+	fnDay := func(s string) time.Time {
+		day, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return day
+	}
+
+	// snapshot holding only the named registries
+	fnSnap := func(s string, sKeys ...string) {
+		dir := SnapshotDayDir(dbPath, fnDay(s))
+		if err := os.MkdirAll(dir, 0775); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range sKeys {
+			writeGzLines(t, filepath.Join(dir, "delegated-"+key+"-extended-latest.txt.gz"), nil)
+		}
+	}
+
+	if _, _, err := NearestSnapshot(dbPath, fnDay("2020-01-01")); err == nil {
+		t.Error("no snapshots: no error")
+	}
+
+	sAll := []string{"afrinic", "apnic", "arin", "lacnic", "ripencc"}
+	fnSnap("2020-01-10", "arin", "ripencc")
+	fnSnap("2020-01-13", "apnic")
+
+	tests := []struct {
+		asOf, want string
+		missing    []string
+	}{
+		{"2020-01-11", "2020-01-10", []string{
+			"delegated-afrinic-extended-latest.txt.gz",
+			"delegated-apnic-extended-latest.txt.gz",
+			"delegated-lacnic-extended-latest.txt.gz",
+		}},
+		{"2020-01-20", "2020-01-13", []string{
+			"delegated-afrinic-extended-latest.txt.gz",
+			"delegated-arin-extended-latest.txt.gz",
+			"delegated-lacnic-extended-latest.txt.gz",
+			"delegated-ripencc-extended-latest.txt.gz",
+		}},
+	}
+	fnCheck := func() {
+		for _, tc := range tests {
+			day, sMissing, err := NearestSnapshot(dbPath, fnDay(tc.asOf))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !day.Equal(fnDay(tc.want)) || !reflect.DeepEqual(sMissing, tc.missing) {
+				t.Errorf("as of %s: got %s lacking %q, want %s lacking %q",
+					tc.asOf, day.Format("2006-01-02"), sMissing, tc.want, tc.missing)
+			}
+		}
+	}
+
+	// nearest partial snapshot, when none are complete
+	fnCheck()
+
+	// a snapshot of the very day wins; else complete snapshots within
+	// SnapshotMaxSkewDays win over nearer partial ones
+	fnSnap("2020-01-01", sAll...)
+	fnSnap("2020-02-01", sAll...)
+	sMissing10 := tests[0].missing
+	sMissing13 := tests[1].missing
+	tests = []struct {
+		asOf, want string
+		missing    []string
+	}{
+		{"2020-01-10", "2020-01-10", sMissing10},
+		{"2020-01-13", "2020-01-13", sMissing13},
+		{"2020-01-06", "2020-01-01", nil},
+		{"2020-01-12", "2020-01-13", sMissing13},
+		{"2020-01-20", "2020-01-13", sMissing13},
+		{"2020-01-27", "2020-02-01", nil},
+		{"2020-02-01", "2020-02-01", nil},
+		{"2019-06-01", "2020-01-01", nil},
+		{"2021-01-01", "2020-02-01", nil},
+	}
+	fnCheck()
+
+	// warned of other days & missing files
+	m := &Modes{DbPath: dbPath}
+	for _, tc := range []struct {
+		asOf  string
+		sWarn []string
+	}{
+		{"2020-02-01", nil},
+		{"2020-01-06", []string{"2020-01-01, 5 day(s) before 2020-01-06"}},
+		{"2020-01-27", []string{"2020-02-01, 5 day(s) after 2020-01-27"}},
+		{"2020-01-10", []string{"2020-01-10 lacks delegated-afrinic"}},
+		{"2020-01-12", []string{"2020-01-13, 1 day(s) after", "2020-01-13 lacks delegated-afrinic"}},
+	} {
+		szOut := captureStderr(t, func() {
+			if _, err := m.nearestSnapshot(fnDay(tc.asOf)); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if (len(tc.sWarn) == 0) && (len(szOut) > 0) {
+			t.Errorf("%s: warned %q", tc.asOf, szOut)
+		}
+		for _, szWarn := range tc.sWarn {
+			if !strings.Contains(szOut, szWarn) {
+				t.Errorf("%s: warned %q, want %q", tc.asOf, szOut, szWarn)
+			}
+		}
+	}
+}
+
+// what fn writes to os.Stderr
+func captureStderr(t *testing.T, fn func()) string {
+	return captureFile(t, &os.Stderr, fn)
+}
+
+// everything fn writes to *ppF (e.g. os.Stdout)
+func captureFile(t *testing.T, ppF **os.File, fn func()) string {
+
+	pF, err := os.CreateTemp(t.TempDir(), "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pF.Close()
+
+	pOld := *ppF
+	*ppF = pF
+	defer func() { *ppF = pOld }()
+	fn()
+
+	bs, err := os.ReadFile(pF.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bs)
+}
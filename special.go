@@ -0,0 +1,382 @@
+package main
+
+import (
+	"net/netip"
+	"os"
+
+	cw "github.com/BourgeoisBear/nicsearch/colwriter"
+	"go.etcd.io/bbolt"
+)
+
+// true/false/not applicable
+type Tri int8
+
+const (
+	TriNA Tri = iota
+	TriFalse
+	TriTrue
+)
+
+func (t Tri) String() string {
+	switch t {
+	case TriFalse:
+		return "false"
+	case TriTrue:
+		return "true"
+	}
+	return "n/a"
+}
+
+// entry of the IANA IPv4/IPv6 special-purpose address registries
+type SpecialBlock struct {
+	Prefix      netip.Prefix
+	Name        string
+	RFC         string
+	Source      Tri
+	Destination Tri
+	Forwardable Tri
+	Global      Tri
+	Reserved    Tri
+}
+
+func spb(pfx, name, rfc string, src, dst, fwd, glob, rsvd Tri) SpecialBlock {
+	return SpecialBlock{
+		Prefix:      netip.MustParsePrefix(pfx),
+		Name:        name,
+		RFC:         rfc,
+		Source:      src,
+		Destination: dst,
+		Forwardable: fwd,
+		Global:      glob,
+		Reserved:    rsvd,
+	}
+}
+
+/*
+https://www.iana.org/assignments/iana-ipv4-special-registry/
+https://www.iana.org/assignments/iana-ipv6-special-registry/
+https://www.iana.org/assignments/multicast-addresses/
+https://www.iana.org/assignments/ipv6-multicast-addresses/
+*/
+var g_specialBlocks = func() []SpecialBlock {
+
+	const (
+		F = TriFalse
+		T = TriTrue
+		X = TriNA
+	)
+
+	return []SpecialBlock{
+
+		// IPv4
+		spb("0.0.0.0/8", "This network", "RFC791", T, F, F, F, T),
+		spb("0.0.0.0/32", "This host on this network", "RFC1122", T, F, F, F, T),
+		spb("10.0.0.0/8", "Private-Use", "RFC1918", T, T, T, F, F),
+		spb("100.64.0.0/10", "Shared Address Space (CGNAT)", "RFC6598", T, T, T, F, F),
+		spb("127.0.0.0/8", "Loopback", "RFC1122", F, F, F, F, T),
+		spb("169.254.0.0/16", "Link Local", "RFC3927", T, T, F, F, T),
+		spb("172.16.0.0/12", "Private-Use", "RFC1918", T, T, T, F, F),
+		spb("192.0.0.0/24", "IETF Protocol Assignments", "RFC6890", F, F, F, F, F),
+		spb("192.0.0.0/29", "IPv4 Service Continuity Prefix", "RFC7335", T, T, T, F, F),
+		spb("192.0.0.8/32", "IPv4 dummy address", "RFC7600", T, F, F, F, F),
+		spb("192.0.0.9/32", "Port Control Protocol Anycast", "RFC7723", T, T, T, T, F),
+		spb("192.0.0.10/32", "Traversal Using Relays around NAT Anycast", "RFC8155", T, T, T, T, F),
+		spb("192.0.0.170/32", "NAT64/DNS64 Discovery", "RFC8880", F, F, F, F, T),
+		spb("192.0.0.171/32", "NAT64/DNS64 Discovery", "RFC8880", F, F, F, F, T),
+		spb("192.0.2.0/24", "Documentation (TEST-NET-1)", "RFC5737", F, F, F, F, F),
+		spb("192.31.196.0/24", "AS112-v4", "RFC7535", T, T, T, T, F),
+		spb("192.52.193.0/24", "AMT", "RFC7450", T, T, T, T, F),
+		spb("192.88.99.0/24", "Deprecated (6to4 Relay Anycast)", "RFC7526", X, X, X, X, X),
+		spb("192.168.0.0/16", "Private-Use", "RFC1918", T, T, T, F, F),
+		spb("192.175.48.0/24", "Direct Delegation AS112 Service", "RFC7534", T, T, T, T, F),
+		spb("198.18.0.0/15", "Benchmarking", "RFC2544", T, T, T, F, F),
+		spb("198.51.100.0/24", "Documentation (TEST-NET-2)", "RFC5737", F, F, F, F, F),
+		spb("203.0.113.0/24", "Documentation (TEST-NET-3)", "RFC5737", F, F, F, F, F),
+		spb("224.0.0.0/4", "Multicast", "RFC5771", F, T, T, F, F),
+		spb("240.0.0.0/4", "Reserved", "RFC1112", F, F, F, F, T),
+		spb("255.255.255.255/32", "Limited Broadcast", "RFC919", F, T, F, F, T),
+
+		// IPv6
+		spb("::/128", "Unspecified Address", "RFC4291", T, F, F, F, T),
+		spb("::1/128", "Loopback Address", "RFC4291", F, F, F, F, T),
+		spb("::ffff:0:0/96", "IPv4-mapped Address", "RFC4291", F, F, F, F, T),
+		spb("64:ff9b::/96", "IPv4-IPv6 Translation (NAT64)", "RFC6052", T, T, T, T, F),
+		spb("64:ff9b:1::/48", "IPv4-IPv6 Translation (local-use NAT64)", "RFC8215", T, T, T, F, F),
+		spb("100::/64", "Discard-Only Address Block", "RFC6666", T, T, T, F, F),
+		spb("2001::/23", "IETF Protocol Assignments", "RFC2928", F, F, F, F, F),
+		spb("2001::/32", "TEREDO", "RFC4380", T, T, T, X, X),
+		spb("2001:1::1/128", "Port Control Protocol Anycast", "RFC7723", T, T, T, T, F),
+		spb("2001:1::2/128", "Traversal Using Relays around NAT Anycast", "RFC8155", T, T, T, T, F),
+		spb("2001:2::/48", "Benchmarking", "RFC5180", T, T, T, F, F),
+		spb("2001:3::/32", "AMT", "RFC7450", T, T, T, T, F),
+		spb("2001:4:112::/48", "AS112-v6", "RFC7535", T, T, T, T, F),
+		spb("2001:10::/28", "Deprecated (previously ORCHID)", "RFC4843", X, X, X, X, X),
+		spb("2001:20::/28", "ORCHIDv2", "RFC7343", T, T, T, T, F),
+		spb("2001:30::/28", "Drone Remote ID Protocol Entity Tags (DETs)", "RFC9374", T, T, T, T, F),
+		spb("2001:db8::/32", "Documentation", "RFC3849", F, F, F, F, F),
+		spb("2002::/16", "6to4", "RFC3056", T, T, T, X, F),
+		spb("2620:4f:8000::/48", "Direct Delegation AS112 Service", "RFC7534", T, T, T, T, F),
+		spb("3fff::/20", "Documentation", "RFC9637", F, F, F, F, F),
+		spb("5f00::/16", "Segment Routing (SRv6) SIDs", "RFC9602", T, T, T, F, F),
+		spb("fc00::/7", "Unique-Local", "RFC4193", T, T, T, F, F),
+		spb("fe80::/10", "Link-Local Unicast", "RFC4291", T, T, F, F, T),
+		spb("ff00::/8", "Multicast", "RFC4291", F, T, T, F, F),
+	}
+}()
+
+// most specific special-purpose block containing ip
+func SpecialBlockOf(ip netip.Addr) (SpecialBlock, bool) {
+
+	var ret SpecialBlock
+	bFound := false
+	for _, sb := range g_specialBlocks {
+		if !sb.Prefix.Contains(ip) {
+			continue
+		}
+		if !bFound || (sb.Prefix.Bits() > ret.Prefix.Bits()) {
+			ret = sb
+			bFound = true
+		}
+	}
+	return ret, bFound
+}
+
+func (cep CmdExecParams) printSpecialBlock(sb SpecialBlock) error {
+
+	writerCfg := cw.Cfg{Spacer: "|", Pad: cep.Pretty}
+	ccfg := []cw.ColCfg{
+		cw.ColCfg{Wid: 7, Title: "SPECIAL"},
+		cw.ColCfg{Wid: 23, Title: "PREFIX", Rt: true},
+		cw.ColCfg{Wid: 7, Title: "RFC"},
+		cw.ColCfg{Wid: 5, Title: "SRC"},
+		cw.ColCfg{Wid: 5, Title: "DST"},
+		cw.ColCfg{Wid: 5, Title: "FWD"},
+		cw.ColCfg{Wid: 5, Title: "GLOBAL"},
+		cw.ColCfg{Wid: 5, Title: "RSVD"},
+		cw.ColCfg{Title: "NAME"},
+	}
+
+	parts := []interface{}{
+		"SPECIAL",
+		sb.Prefix.String(),
+		sb.RFC,
+		sb.Source.String(),
+		sb.Destination.String(),
+		sb.Forwardable.String(),
+		sb.Global.String(),
+		sb.Reserved.String(),
+		sb.Name,
+	}
+
+	if cep.PrependQuery {
+		ccfg = append([]cw.ColCfg{cw.ColCfg{Wid: cep.MaxCmdLen}}, ccfg...)
+		parts = append([]interface{}{cep.Cmd}, parts...)
+	}
+
+	_, err := writerCfg.NewWriterFuncs(ccfg)(os.Stdout, parts...)
+	return err
+}
+
+// entry of the IANA special-purpose AS numbers registry, and
+// related reservations from the AS numbers registry
+type SpecialAsn struct {
+	First, Last uint32
+	Name        string
+	RFC         string
+}
+
+var g_specialAsns = []SpecialAsn{
+	{0, 0, "Reserved, may not be used to identify a network", "RFC7607"},
+	{112, 112, "AS112 DNS sink project", "RFC7534"},
+	{23456, 23456, "AS_TRANS, stands in for 4-byte ASNs toward 2-byte only speakers", "RFC6793"},
+	{64496, 64511, "Documentation", "RFC5398"},
+	{64512, 65534, "Private use", "RFC6996"},
+	{65535, 65535, "Reserved, last 16-bit ASN", "RFC7300"},
+	{65536, 65551, "Documentation", "RFC5398"},
+	{65552, 131071, "Reserved by IANA", "IANA"},
+	{4200000000, 4294967294, "Private use", "RFC6996"},
+	{4294967295, 4294967295, "Reserved, last 32-bit ASN", "RFC7300"},
+}
+
+func SpecialAsnOf(nASN uint32) (SpecialAsn, bool) {
+	for _, sa := range g_specialAsns {
+		if (nASN >= sa.First) && (nASN <= sa.Last) {
+			return sa, true
+		}
+	}
+	return SpecialAsn{}, false
+}
+
+func (cep CmdExecParams) printSpecialAsn(sa SpecialAsn) error {
+
+	writerCfg := cw.Cfg{Spacer: "|", Pad: cep.Pretty}
+	ccfg := []cw.ColCfg{
+		cw.ColCfg{Wid: 7, Title: "SPECIAL"},
+		cw.ColCfg{Wid: 10, Title: "FROM", Rt: true},
+		cw.ColCfg{Wid: 10, Title: "TO", Rt: true},
+		cw.ColCfg{Wid: 7, Title: "RFC"},
+		cw.ColCfg{Title: "NAME"},
+	}
+
+	szLast := ""
+	if sa.Last != sa.First {
+		szLast = FormatASN(sa.Last, cep.AsDot)
+	}
+
+	parts := []interface{}{
+		"SPECIAL",
+		FormatASN(sa.First, cep.AsDot),
+		szLast,
+		sa.RFC,
+		sa.Name,
+	}
+
+	if cep.PrependQuery {
+		ccfg = append([]cw.ColCfg{cw.ColCfg{Wid: cep.MaxCmdLen}}, ccfg...)
+		parts = append([]interface{}{cep.Cmd}, parts...)
+	}
+
+	_, err := writerCfg.NewWriterFuncs(ccfg)(os.Stdout, parts...)
+	return err
+}
+
+// IPv4 address carried inside of an IPv6 transition address
+type EmbeddedV4 struct {
+	Mechanism string
+	IP        netip.Addr
+}
+
+var (
+	g_pfx6to4   = netip.MustParsePrefix("2002::/16")
+	g_pfxTeredo = netip.MustParsePrefix("2001::/32")
+	g_pfxNat64  = netip.MustParsePrefix("64:ff9b::/96")
+)
+
+func EmbeddedV4Of(ip netip.Addr) []EmbeddedV4 {
+
+	if !ip.Is6() {
+		return nil
+	}
+
+	if ip.Is4In6() {
+		return []EmbeddedV4{{"IPv4-mapped", ip.Unmap()}}
+	}
+
+	bs := ip.As16()
+	v4At := func(ix int, xor byte) netip.Addr {
+		return netip.AddrFrom4([4]byte{
+			bs[ix] ^ xor, bs[ix+1] ^ xor, bs[ix+2] ^ xor, bs[ix+3] ^ xor,
+		})
+	}
+
+	switch {
+	case g_pfx6to4.Contains(ip):
+		return []EmbeddedV4{{"6to4", v4At(2, 0)}}
+
+	case g_pfxTeredo.Contains(ip):
+		// client address is obfuscated by inverting all bits
+		return []EmbeddedV4{
+			{"Teredo server", v4At(4, 0)},
+			{"Teredo client", v4At(12, 0xFF)},
+		}
+
+	case g_pfxNat64.Contains(ip):
+		return []EmbeddedV4{{"NAT64", v4At(12, 0)}}
+	}
+
+	return nil
+}
+
+type CmdBogons struct {
+	Prefix netip.Prefix // invalid for whole IPv4 & IPv6 spaces
+}
+
+// undelegated space & non-global special-purpose blocks,
+// minus special-purpose blocks that are (or may be) globally reachable
+func BogonsTx(tx *bbolt.Tx, within IpSpan) ([]IpSpan, error) {
+
+	sBogons, err := GapsTx(tx, within)
+	if err != nil {
+		return nil, err
+	}
+
+	var sGlobal []IpSpan
+	for _, sb := range g_specialBlocks {
+
+		if sb.Prefix.Addr().Is4() != within.First.Is4() {
+			continue
+		}
+
+		span := PrefixSpan(sb.Prefix)
+		if span.Last.Less(within.First) || within.Last.Less(span.First) {
+			continue
+		}
+		if within.First.Compare(span.First) > 0 {
+			span.First = within.First
+		}
+		if within.Last.Compare(span.Last) < 0 {
+			span.Last = within.Last
+		}
+
+		if sb.Global == TriFalse {
+			sBogons = append(sBogons, span)
+		} else {
+			sGlobal = append(sGlobal, span)
+		}
+	}
+
+	sBogons = MergeSpans(sBogons)
+	sGlobal = MergeSpans(sGlobal)
+	if len(sGlobal) == 0 {
+		return sBogons, nil
+	}
+
+	var ret []IpSpan
+	for _, span := range sBogons {
+		ret = append(ret, SubtractSpans(span, sGlobal)...)
+	}
+	return ret, nil
+}
+
+func (v CmdBogons) Exec(cep CmdExecParams) error {
+
+	writerCfg := cw.Cfg{Spacer: "|", Pad: cep.Pretty}
+	ccfg := []cw.ColCfg{
+		cw.ColCfg{Wid: 4, Title: "TYPE"},
+		cw.ColCfg{Title: "BOGON"},
+	}
+	if cep.PrependQuery {
+		ccfg = append([]cw.ColCfg{cw.ColCfg{Wid: cep.MaxCmdLen}}, ccfg...)
+	}
+	oWF := writerCfg.NewWriterFuncs(ccfg)
+
+	return cep.Db.View(func(tx *bbolt.Tx) error {
+
+		for _, pfx := range CmdGaps(v).prefixes() {
+
+			sBogons, err := BogonsTx(tx, PrefixSpan(pfx))
+			if err != nil {
+				return err
+			}
+
+			addrVer := "IPV4"
+			if pfx.Addr().Is6() {
+				addrVer = "IPV6"
+			}
+
+			for _, span := range sBogons {
+				for _, bogon := range span.Prefixes() {
+					parts := []interface{}{addrVer, bogon.String()}
+					if cep.PrependQuery {
+						parts = append([]interface{}{cep.Cmd}, parts...)
+					}
+					if _, err := oWF(os.Stdout, parts...); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		return nil
+	})
+}
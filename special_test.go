@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestEmbeddedV4Of(t *testing.T) {
+
+	tests := []struct {
+		ip   string
+		want []EmbeddedV4
+	}{
+		{"2002:c000:22d::1", []EmbeddedV4{{"6to4", netip.MustParseAddr("192.0.2.45")}}},
+		{"2001:0:4136:e378:8000:63bf:3fff:fdd2", []EmbeddedV4{
+			{"Teredo server", netip.MustParseAddr("65.54.227.120")},
+			{"Teredo client", netip.MustParseAddr("192.0.2.45")},
+		}},
+		{"64:ff9b::c000:22d", []EmbeddedV4{{"NAT64", netip.MustParseAddr("192.0.2.45")}}},
+		{"::ffff:192.0.2.45", []EmbeddedV4{{"IPv4-mapped", netip.MustParseAddr("192.0.2.45")}}},
+		{"2001:db8::1", nil},
+		{"64:ff9b:1::c000:22d", nil}, // local-use NAT64: no well-known layout
+		{"192.0.2.45", nil},
+	}
+
+	for _, tc := range tests {
+		if got := EmbeddedV4Of(netip.MustParseAddr(tc.ip)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.ip, got, tc.want)
+		}
+	}
+}
+
+func TestBogonsTx(t *testing.T) {
+
+	db := newTestIndex(t, []string{
+		"arin|US|ipv4|192.0.128.0|32768|20000101|allocated|ORG-A",
+		"arin|US|ipv4|198.51.0.0|65536|20000101|allocated|ORG-B",
+	})
+
+	tests := []struct {
+		within string
+		want   []string // first-last of each bogon span
+	}{
+		// undelegated half, less global anycast 192.0.0.9 & 192.0.0.10
+		{"192.0.0.0/16", []string{"192.0.0.0-192.0.0.8", "192.0.0.11-192.0.127.255"}},
+
+		// delegated, save for documentation block
+		{"198.51.0.0/16", []string{"198.51.100.0-198.51.100.255"}},
+
+		// undelegated, less deprecated 6to4 relay (may be global)
+		{"192.88.0.0/16", []string{"192.88.0.0-192.88.98.255", "192.88.100.0-192.88.255.255"}},
+	}
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		for _, tc := range tests {
+
+			sSpans, err := BogonsTx(tx, PrefixSpan(netip.MustParsePrefix(tc.within)))
+			if err != nil {
+				return err
+			}
+
+			var got []string
+			for _, span := range sSpans {
+				got = append(got, span.First.String()+"-"+span.Last.String())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s: got %q, want %q", tc.within, got, tc.want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	cw "github.com/BourgeoisBear/nicsearch/colwriter"
+	"go.etcd.io/bbolt"
+)
+
+type statsCount struct {
+	Key   string
+	Desc  string
+	Count uint64
+}
+
+type statsGroup struct {
+	By      string
+	mCounts map[string]*statsCount
+}
+
+func (pG *statsGroup) add(key, desc string) {
+	if pG.mCounts == nil {
+		pG.mCounts = make(map[string]*statsCount)
+	}
+	pC, ok := pG.mCounts[key]
+	if !ok {
+		pC = &statsCount{Key: key, Desc: desc}
+		pG.mCounts[key] = pC
+	}
+	pC.Count += 1
+}
+
+// counts in descending order, limited to nTop (0 for all)
+func (pG *statsGroup) top(nTop int) []*statsCount {
+
+	ret := make([]*statsCount, 0, len(pG.mCounts))
+	for _, pC := range pG.mCounts {
+		ret = append(ret, pC)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Key < ret[j].Key
+	})
+	if (nTop > 0) && (len(ret) > nTop) {
+		ret = ret[:nTop]
+	}
+	return ret
+}
+
+type IpStats struct {
+	*Modes
+	Unique bool
+
+	NTotal, NMatched, NInvalid uint64
+
+	Groups []statsGroup // CC, RIR, ASN, ORG
+
+	mSeen   map[netip.Addr]bool
+	mOrgAsn map[string]IpOrg
+}
+
+func NewIpStats(m *Modes, bUnique bool) *IpStats {
+	return &IpStats{
+		Modes:   m,
+		Unique:  bUnique,
+		Groups:  []statsGroup{{By: "CC"}, {By: "RIR"}, {By: "ASN"}, {By: "ORG"}},
+		mSeen:   make(map[netip.Addr]bool),
+		mOrgAsn: make(map[string]IpOrg),
+	}
+}
+
+// tally a batch of addresses inside of one read transaction
+func (pS *IpStats) addBatchTx(tx *bbolt.Tx, sIPs []netip.Addr) error {
+
+	sRows, sErrs := IpToRowBatchTx(tx, sIPs, pS.Statuses)
+	for ix := range sIPs {
+
+		pS.NTotal += 1
+		if sErrs[ix] != nil {
+			if (sErrs[ix] != ENotFound) && (sErrs[ix] != EInvalidIpAddress) {
+				return sErrs[ix]
+			}
+			continue
+		}
+
+		row := sRows[ix]
+		pS.NMatched += 1
+
+		// organization's ASN, cached by reg-id
+		szOrg := string(row.Registry) + ":" + string(row.RegId)
+		org, ok := pS.mOrgAsn[szOrg]
+		if !ok {
+			org.Row = row
+			if err := org.findASN(tx); err != nil {
+				return err
+			}
+			pS.mOrgAsn[szOrg] = org
+		}
+
+		szAsn, szAsName := "-", ""
+		if org.HasASN {
+			szAsn = "AS" + FormatASN(org.ASN, pS.AsDot)
+			szAsName = string(org.AsName)
+		}
+
+		pS.Groups[0].add(string(row.Cc), "")
+		pS.Groups[1].add(strings.ToLower(string(row.Registry)), "")
+		pS.Groups[2].add(szAsn, szAsName)
+		pS.Groups[3].add(szOrg, szAsName)
+	}
+
+	return nil
+}
+
+// one address per line: blank lines & lines starting with '#' are skipped
+func (pS *IpStats) Read(db *bbolt.DB, iRd io.Reader) error {
+
+	sc := bufio.NewScanner(iRd)
+	sIPs := make([]netip.Addr, 0, BulkChunkLen)
+
+	fnFlush := func() error {
+		if len(sIPs) == 0 {
+			return nil
+		}
+		err := db.View(func(tx *bbolt.Tx) error {
+			return pS.addBatchTx(tx, sIPs)
+		})
+		sIPs = sIPs[:0]
+		return err
+	}
+
+	for sc.Scan() {
+
+		sz := strings.TrimSpace(sc.Text())
+		if (len(sz) == 0) || strings.HasPrefix(sz, "#") {
+			continue
+		}
+
+		ip, err := ParseAddrLoose(sz)
+		if err != nil {
+			pS.NTotal += 1
+			pS.NInvalid += 1
+			continue
+		}
+		ip = ip.Unmap()
+
+		if pS.Unique {
+			if pS.mSeen[ip] {
+				continue
+			}
+			pS.mSeen[ip] = true
+		}
+
+		if sIPs = append(sIPs, ip); len(sIPs) == BulkChunkLen {
+			if err = fnFlush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := fnFlush(); err != nil {
+		return err
+	}
+	return sc.Err()
+}
+
+func (pS *IpStats) Print(iWri io.Writer, nTop int) error {
+
+	writerCfg := cw.Cfg{Spacer: "|", Pad: pS.Pretty}
+	oWF := writerCfg.NewWriterFuncs([]cw.ColCfg{
+		cw.ColCfg{Wid: 3, Title: "BY"},
+		cw.ColCfg{Wid: 20, Title: "KEY"},
+		cw.ColCfg{Wid: 10, Title: "COUNT", Rt: true},
+		cw.ColCfg{Wid: 6, Title: "PCT", Rt: true},
+		cw.ColCfg{Title: "NAME"},
+	})
+
+	for ixG := range pS.Groups {
+		for _, pC := range pS.Groups[ixG].top(nTop) {
+
+			pct := 0.0
+			if pS.NMatched > 0 {
+				pct = 100 * float64(pC.Count) / float64(pS.NMatched)
+			}
+
+			_, err := oWF(iWri,
+				pS.Groups[ixG].By,
+				pC.Key,
+				fmt.Sprint(pC.Count),
+				fmt.Sprintf("%.2f", pct),
+				pC.Desc,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	pS.AnsiMsg(os.Stderr, "STATS", fmt.Sprintf(
+		"%d addresses, %d matched, %d unmatched, %d invalid",
+		pS.NTotal, pS.NMatched, pS.NTotal-pS.NMatched-pS.NInvalid, pS.NInvalid,
+	), []uint8{1, 96})
+
+	return nil
+}
+
+// 'stats' sub-command: parses its own flags from sArgs
+func (m *Modes) Stats(db *bbolt.DB, sArgs []string) error {
+
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	szIn := fs.String("in", "-", "input `FILE` ('-' for stdin), with one IP address per line")
+	nTop := fs.Int("top", 10, "rows per table (0 for all)")
+	bUnique := fs.Bool("unique", false, "count each distinct address once")
+	if err := fs.Parse(sArgs); err != nil {
+		return err
+	}
+
+	var iRd io.Reader = os.Stdin
+	if *szIn != "-" {
+		pF, err := os.Open(*szIn)
+		if err != nil {
+			return err
+		}
+		defer pF.Close()
+		iRd = pF
+	}
+
+	pS := NewIpStats(m, *bUnique)
+	if err := pS.Read(db, iRd); err != nil {
+		return err
+	}
+	return pS.Print(os.Stdout, *nTop)
+}
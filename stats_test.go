@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIpStats(t *testing.T) {
+
+	db := newTestIndex(t, []string{
+		"arin|US|ipv4|10.0.0.0|16777216|20000101|allocated|ORG-A",
+		"arin|US|asn|64512|1|20000101|assigned|ORG-A",
+		"ripencc|NL|ipv4|11.0.0.0|256|20000101|allocated|ORG-B",
+		"ripencc|NL|ipv4|12.0.0.0|256|20000101|reserved|",
+	})
+
+	const input = `# two unmatched, one invalid
+10.0.0.1
+10.0.0.2
+10.0.0.1
+
+11.0.0.1
+12.0.0.1
+13.0.0.1
+bogus
+`
+
+	tests := []struct {
+		unique    bool
+		nTotal    uint64
+		nMatched  uint64
+		nInvalid  uint64
+		sWant     []string // BY|KEY|COUNT|PCT|NAME
+		szSummary string
+	}{
+		{
+			false, 7, 4, 1,
+			[]string{
+				"CC|US|3|75.00|", "CC|NL|1|25.00|",
+				"RIR|arin|3|75.00|", "RIR|ripencc|1|25.00|",
+				"ASN|AS64512|3|75.00|", "ASN|-|1|25.00|",
+				"ORG|ARIN:ORG-A|3|75.00|", "ORG|RIPENCC:ORG-B|1|25.00|",
+			},
+			"7 addresses, 4 matched, 2 unmatched, 1 invalid",
+		},
+		{
+			true, 6, 3, 1,
+			[]string{
+				"CC|US|2|66.67|", "CC|NL|1|33.33|",
+				"RIR|arin|2|66.67|", "RIR|ripencc|1|33.33|",
+				"ASN|AS64512|2|66.67|", "ASN|-|1|33.33|",
+				"ORG|ARIN:ORG-A|2|66.67|", "ORG|RIPENCC:ORG-B|1|33.33|",
+			},
+			"6 addresses, 3 matched, 2 unmatched, 1 invalid",
+		},
+	}
+
+	for _, tc := range tests {
+
+		pS := NewIpStats(&Modes{Statuses: DefaultStatusSet()}, tc.unique)
+		if err := pS.Read(db, strings.NewReader(input)); err != nil {
+			t.Fatal(err)
+		}
+		if (pS.NTotal != tc.nTotal) || (pS.NMatched != tc.nMatched) || (pS.NInvalid != tc.nInvalid) {
+			t.Errorf("unique %v: %d total, %d matched, %d invalid; want %d, %d, %d",
+				tc.unique, pS.NTotal, pS.NMatched, pS.NInvalid, tc.nTotal, tc.nMatched, tc.nInvalid)
+		}
+
+		var buf bytes.Buffer
+		szErr := captureStderr(t, func() {
+			if err := pS.Print(&buf, 0); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		sGot := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if !reflect.DeepEqual(sGot, tc.sWant) {
+			t.Errorf("unique %v: got %q, want %q", tc.unique, sGot, tc.sWant)
+		}
+		if !strings.Contains(szErr, tc.szSummary) {
+			t.Errorf("unique %v: summary %q, want %q", tc.unique, szErr, tc.szSummary)
+		}
+	}
+}
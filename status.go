@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// delegation statuses to report (upper-case)
+type StatusSet map[string]bool
+
+var g_allStatuses = []string{"ALLOCATED", "ASSIGNED", "RESERVED", "AVAILABLE"}
+
+func DefaultStatusSet() StatusSet {
+	return StatusSet{"ALLOCATED": true, "ASSIGNED": true}
+}
+
+func AllStatusSet() StatusSet {
+	ret := make(StatusSet, len(g_allStatuses))
+	for _, st := range g_allStatuses {
+		ret[st] = true
+	}
+	return ret
+}
+
+// comma-separated list of statuses, or 'all'
+func ParseStatusSet(sz string) (StatusSet, error) {
+
+	ret := make(StatusSet)
+	for _, part := range strings.Split(sz, ",") {
+
+		part = strings.ToUpper(strings.TrimSpace(part))
+		switch part {
+		case "":
+			continue
+		case "ALL":
+			for st := range AllStatusSet() {
+				ret[st] = true
+			}
+			continue
+		}
+
+		bValid := false
+		for _, st := range g_allStatuses {
+			if part == st {
+				bValid = true
+				break
+			}
+		}
+		if !bValid {
+			return nil, fmt.Errorf(
+				"'%s' is not a valid status.  Valid statuses are: %s, and ALL.",
+				part, strings.Join(g_allStatuses, ", "),
+			)
+		}
+		ret[part] = true
+	}
+
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("empty status list")
+	}
+	return ret, nil
+}
+
+func (ss StatusSet) Has(bsStatus []byte) bool {
+	return ss[string(bytes.ToUpper(bsStatus))]
+}
+
+// raw (upper-case) delegation line of a status in the set
+func (ss StatusSet) HasLine(bsLine []byte) bool {
+	for st := range ss {
+		if bytes.Contains(bsLine, []byte("|"+st+"|")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ss StatusSet) Filter(sRows []Row) []Row {
+	ret := sRows[:0]
+	for ix := range sRows {
+		if ss.Has(sRows[ix].Status) {
+			ret = append(ret, sRows[ix])
+		}
+	}
+	return ret
+}
+
+// flag.Value for -include-status, adding to the default set
+type statusFlag struct {
+	pSet *StatusSet
+}
+
+func (sf statusFlag) String() string {
+	if (sf.pSet == nil) || (len(*sf.pSet) == 0) {
+		return ""
+	}
+	var parts []string
+	for _, st := range g_allStatuses {
+		if (*sf.pSet)[st] {
+			parts = append(parts, strings.ToLower(st))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func (sf statusFlag) Set(sz string) error {
+	ss, err := ParseStatusSet(sz)
+	if err != nil {
+		return err
+	}
+	for k := range ss {
+		(*sf.pSet)[k] = true
+	}
+	return nil
+}
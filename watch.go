@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	cw "github.com/BourgeoisBear/nicsearch/colwriter"
+	"go.etcd.io/bbolt"
+)
+
+type CmdWatch struct {
+	Op    string
+	Query string
+}
+
+type WatchItem struct {
+	Query string
+	Rows  []string
+}
+
+type Watchlist struct {
+	Items []WatchItem
+
+	// rows were saved regardless of -include-status (lists from before
+	// this are re-baselined on their next check)
+	AllStatuses bool
+}
+
+type WatchChange struct {
+	Query   string
+	Added   []string
+	Removed []string
+}
+
+type WatchReport struct {
+	Time    time.Time
+	Changes []WatchChange
+}
+
+func WatchlistPath(dbPath string) string {
+	return filepath.Join(dbPath, "watchlist.json")
+}
+
+func LoadWatchlist(dbPath string) (Watchlist, error) {
+
+	var ret Watchlist
+	bs, err := os.ReadFile(WatchlistPath(dbPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ret, nil
+		}
+		return ret, err
+	}
+	err = json.Unmarshal(bs, &ret)
+	return ret, err
+}
+
+func (wl Watchlist) Save(dbPath string) error {
+
+	bs, err := json.MarshalIndent(wl, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write-then-rename, so a failed write keeps the old list
+	fname := WatchlistPath(dbPath)
+	tmp := fname + ".tmp"
+	if err = os.WriteFile(tmp, bs, 0664); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fname)
+}
+
+func (wl Watchlist) Find(query string) int {
+	for ix := range wl.Items {
+		if wl.Items[ix].Query == query {
+			return ix
+		}
+	}
+	return -1
+}
+
+/*
+sorted row lines of a watched query, of every status, so that snapshots
+do not depend on the -include-status of the run taking them.
+*/
+func (m *Modes) watchRows(db *bbolt.DB, query string) ([]string, error) {
+
+	iCmd, err := m.ParseCmd(query)
+	if err != nil {
+		return nil, err
+	}
+
+	iLister, ok := iCmd.(RowLister)
+	if !ok {
+		return nil, fmt.Errorf("'%s' cannot be watched (only 'as', 'ip', 'net', 'cc', 'na' & 'st' queries)", query)
+	}
+
+	mAll := *m
+	mAll.Statuses = AllStatusSet()
+	sRows, err := mAll.listRows(db, iLister)
+	if (err != nil) && (err != ENotFound) {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(sRows))
+	for ix := range sRows {
+		ret = append(ret, sRows[ix].Line())
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// lines in sA but not in sB (both sorted)
+func sortedMinus(sA, sB []string) []string {
+	var ret []string
+	for _, v := range sA {
+		ix := sort.SearchStrings(sB, v)
+		if (ix >= len(sB)) || (sB[ix] != v) {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// re-evaluate all watched queries, report & persist changes
+func (m *Modes) CheckWatchlist(db *bbolt.DB) (WatchReport, error) {
+
+	rpt := WatchReport{Time: time.Now()}
+
+	wl, err := LoadWatchlist(m.DbPath)
+	if err != nil || (len(wl.Items) == 0) {
+		return rpt, err
+	}
+
+	for ix := range wl.Items {
+
+		pItem := &wl.Items[ix]
+		sRows, err := m.watchRows(db, pItem.Query)
+		if err != nil {
+			m.printErr(err, pItem.Query)
+			continue
+		}
+
+		chg := WatchChange{
+			Query:   pItem.Query,
+			Added:   sortedMinus(sRows, pItem.Rows),
+			Removed: sortedMinus(pItem.Rows, sRows),
+		}
+		if wl.AllStatuses && (len(chg.Added) > 0 || len(chg.Removed) > 0) {
+			rpt.Changes = append(rpt.Changes, chg)
+		}
+		pItem.Rows = sRows
+	}
+	wl.AllStatuses = true
+
+	if err = wl.Save(m.DbPath); err != nil {
+		return rpt, err
+	}
+
+	if len(rpt.Changes) == 0 {
+		return rpt, nil
+	}
+
+	if err = m.printWatchReport(rpt); err != nil {
+		return rpt, err
+	}
+	return rpt, m.notifyWatchReport(rpt)
+}
+
+func (m *Modes) printWatchReport(rpt WatchReport) error {
+
+	writerCfg := cw.Cfg{Spacer: "|", Pad: m.Pretty}
+	oWF := writerCfg.NewWriterFuncs([]cw.ColCfg{
+		cw.ColCfg{Wid: 20, Title: "WATCH"},
+		cw.ColCfg{Wid: 1, Title: "CHG"},
+		cw.ColCfg{Title: "ROW"},
+	})
+
+	for _, chg := range rpt.Changes {
+		for _, sGrp := range []struct {
+			sym   string
+			sRows []string
+		}{
+			{"+", chg.Added},
+			{"-", chg.Removed},
+		} {
+			for _, line := range sGrp.sRows {
+				if _, err := oWF(os.Stdout, chg.Query, sGrp.sym, line); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// webhook client: a stuck -watchurl must not hang the rebuild it follows
+// (swapped in tests)
+var g_watchHTTP = &http.Client{Timeout: 30 * time.Second}
+
+// run user hook and/or POST to webhook, with JSON report as input
+func (m *Modes) notifyWatchReport(rpt WatchReport) error {
+
+	if (len(m.WatchCmd) == 0) && (len(m.WatchURL) == 0) {
+		return nil
+	}
+
+	bsJSON, err := json.Marshal(rpt)
+	if err != nil {
+		return err
+	}
+
+	if len(m.WatchCmd) > 0 {
+
+		var pCmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			pCmd = exec.Command("cmd", "/C", m.WatchCmd)
+		} else {
+			pCmd = exec.Command("sh", "-c", m.WatchCmd)
+		}
+		pCmd.Stdin = bytes.NewReader(bsJSON)
+		pCmd.Stdout = os.Stdout
+		pCmd.Stderr = os.Stderr
+		if err = pCmd.Run(); err != nil {
+			return fmt.Errorf("watch hook: %w", err)
+		}
+	}
+
+	if len(m.WatchURL) > 0 {
+
+		rsp, err := g_watchHTTP.Post(m.WatchURL, "application/json", bytes.NewReader(bsJSON))
+		if err != nil {
+			return fmt.Errorf("watch webhook: %w", err)
+		}
+		rsp.Body.Close()
+
+		if (rsp.StatusCode < 200) || (rsp.StatusCode > 299) {
+			return fmt.Errorf("watch webhook: %s: %s", rsp.Status, m.WatchURL)
+		}
+	}
+
+	return nil
+}
+
+func (v CmdWatch) Exec(cep CmdExecParams) error {
+
+	// snapshots are of current data only
+	if !cep.AsOf.IsZero() && (v.Op != "LS") {
+		return fmt.Errorf("the watchlist is read-only under -asof (%s)", cep.AsOf.Format("2006-01-02"))
+	}
+
+	wl, err := LoadWatchlist(cep.DbPath)
+	if err != nil {
+		return err
+	}
+
+	switch v.Op {
+
+	case "ADD":
+		if wl.Find(v.Query) >= 0 {
+			return fmt.Errorf("'%s' is already watched", v.Query)
+		}
+		sRows, err := cep.watchRows(cep.Db, v.Query)
+		if err != nil {
+			return err
+		}
+		if len(wl.Items) == 0 {
+			wl.AllStatuses = true
+		}
+		wl.Items = append(wl.Items, WatchItem{Query: v.Query, Rows: sRows})
+		return wl.Save(cep.DbPath)
+
+	case "RM":
+		ix := wl.Find(v.Query)
+		if ix < 0 {
+			return ENotFound
+		}
+		wl.Items = append(wl.Items[:ix], wl.Items[ix+1:]...)
+		return wl.Save(cep.DbPath)
+
+	case "LS":
+		writerCfg := cw.Cfg{Spacer: "|", Pad: cep.Pretty}
+		oWF := writerCfg.NewWriterFuncs([]cw.ColCfg{
+			cw.ColCfg{Wid: 20, Title: "WATCH"},
+			cw.ColCfg{Title: "ROWS"},
+		})
+		for _, item := range wl.Items {
+			if _, err := oWF(os.Stdout, item.Query, fmt.Sprint(len(item.Rows))); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "CHECK":
+		_, err := cep.CheckWatchlist(cep.Db)
+		return err
+	}
+
+	return EInvalidQuery
+}
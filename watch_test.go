@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func watchTestRows() []string {
+	return []string{
+		"arin|US|ipv4|192.0.2.0|256|20000101|allocated|ORG-A",
+		"arin|US|ipv4|198.51.100.0|256|20000101|reserved|",
+		"arin|US|ipv4|203.0.113.0|256|20000101|available|",
+		"ripencc|NL|ipv4|100.64.0.0|256|20000101|assigned|ORG-B",
+	}
+}
+
+func TestWatchRowsAllStatuses(t *testing.T) {
+
+	db := newTestIndex(t, watchTestRows())
+
+	var sWant []string
+	for ix, szStatuses := range []string{"allocated,assigned", "reserved", "all"} {
+
+		ss, err := ParseStatusSet(szStatuses)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := &Modes{Statuses: ss, DbPath: t.TempDir()}
+		sRows, err := m.watchRows(db, "CC US")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ix == 0 {
+			sWant = sRows
+			if len(sWant) != 3 {
+				t.Errorf("%d rows, want all 3 US rows: %q", len(sWant), sWant)
+			}
+		} else if !reflect.DeepEqual(sRows, sWant) {
+			t.Errorf("-include-status %s: got %q, want %q", szStatuses, sRows, sWant)
+		}
+	}
+}
+
+func TestCheckWatchlist(t *testing.T) {
+
+	db := newTestIndex(t, watchTestRows())
+	m := &Modes{Statuses: DefaultStatusSet(), DbPath: t.TempDir()}
+
+	// list saved with rows of the default statuses only
+	wl := Watchlist{Items: []WatchItem{{
+		Query: "CC US",
+		Rows:  []string{"ARIN|US|IPV4|192.0.2.0|256|20000101|ALLOCATED|ORG-A"},
+	}}}
+	if err := wl.Save(m.DbPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// re-baselined, rather than reporting other statuses as new
+	rpt, err := m.CheckWatchlist(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpt.Changes) > 0 {
+		t.Errorf("re-baseline reported %+v", rpt.Changes)
+	}
+	wl, err = LoadWatchlist(m.DbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wl.AllStatuses || (len(wl.Items[0].Rows) != 3) {
+		t.Fatalf("not re-baselined: %+v", wl)
+	}
+
+	// a change since the last check is reported
+	sFull := wl.Items[0].Rows
+	wl.Items[0].Rows = sFull[1:]
+	if err = wl.Save(m.DbPath); err != nil {
+		t.Fatal(err)
+	}
+	if rpt, err = m.CheckWatchlist(db); err != nil {
+		t.Fatal(err)
+	}
+	if (len(rpt.Changes) != 1) || !reflect.DeepEqual(rpt.Changes[0].Added, sFull[:1]) || (len(rpt.Changes[0].Removed) > 0) {
+		t.Errorf("got %+v, want %s added", rpt.Changes, sFull[0])
+	}
+}
+
+func TestWatchAsOfReadOnly(t *testing.T) {
+
+	db := newTestIndex(t, watchTestRows())
+	cep := CmdExecParams{
+		Modes: Modes{Statuses: DefaultStatusSet(), DbPath: t.TempDir(), AsOf: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		Db:    db,
+	}
+
+	for _, op := range []string{"ADD", "RM", "CHECK"} {
+		if err := (CmdWatch{Op: op, Query: "CC US"}).Exec(cep); err == nil {
+			t.Errorf("%s: allowed under -asof", op)
+		}
+	}
+	if _, err := os.Stat(WatchlistPath(cep.DbPath)); !os.IsNotExist(err) {
+		t.Errorf("watchlist written under -asof: %v", err)
+	}
+
+	if err := (CmdWatch{Op: "LS"}).Exec(cep); err != nil {
+		t.Errorf("LS: %v", err)
+	}
+}
+
+func TestOpenIndexRebuilt(t *testing.T) {
+
+	dir := t.TempDir()
+	fDeleg := filepath.Join(dir, "delegated-test.txt.gz")
+	fAsn := filepath.Join(dir, "asn.txt.gz")
+	fDb := filepath.Join(dir, "test.db")
+	writeGzLines(t, fDeleg, append([]string{"2|test|20240101|1|19700101|20240101|+0000"}, watchTestRows()...))
+	writeGzLines(t, fAsn, []string{"64496 TEST-AS, ZZ"})
+
+	m := &Modes{Statuses: DefaultStatusSet()}
+	fnOpen := func(bReIndex, bWant bool) {
+		db, bRebuilt, err := m.OpenIndex(fDb, bReIndex, []string{fDeleg}, fAsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if bRebuilt != bWant {
+			t.Errorf("reindex %v: rebuilt %v, want %v", bReIndex, bRebuilt, bWant)
+		}
+	}
+
+	fnOpen(true, true)
+	fnOpen(false, false)
+
+	// outdated index is rebuilt, and says so
+	db, _, err := m.OpenIndex(fDb, false, []string{fDeleg}, fAsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(BiMeta.Key()).Put([]byte("version"), []byte("1"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fnOpen(false, true)
+	fnOpen(false, false)
+}
+
+func TestNotifyWatchReportTimeout(t *testing.T) {
+
+	chDone := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-chDone:
+		}
+	}))
+	defer srv.Close()
+	defer close(chDone)
+
+	pOld := g_watchHTTP
+	g_watchHTTP = &http.Client{Timeout: 50 * time.Millisecond}
+	defer func() { g_watchHTTP = pOld }()
+
+	m := &Modes{WatchURL: srv.URL}
+	tStart := time.Now()
+	if err := m.notifyWatchReport(WatchReport{}); err == nil {
+		t.Error("stuck webhook: no error")
+	}
+	if dur := time.Since(tStart); dur > 5*time.Second {
+		t.Errorf("stuck webhook held for %s", dur)
+	}
+}